@@ -0,0 +1,519 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// ============================================================================================================================
+// Access Control - Go port of permissions.acl
+//
+// Before a function runs Invoke() describes what it does as one or more AclRequests (who, which operation, on which
+// resource) and every one must be allowed by the rule table. As in Composer rules are evaluated in order and the first
+// rule that matches decides; if none match the request is denied. In "allow" mode the ACL file's Default rule, allowing
+// anything, is added at the end. The mode is set by Init() and is "deny" unless set otherwise.
+// ============================================================================================================================
+
+const (
+	AclRead   = "READ"
+	AclCreate = "CREATE"
+	AclUpdate = "UPDATE"
+	AclDelete = "DELETE"
+	AclAll    = "ALL"
+	AclInvoke = "INVOKE" // calling a function acl_requests() does not describe
+
+	AclAllow = "ALLOW"
+	AclDeny  = "DENY"
+
+	AclAny = "ANY" // any participant, or any resource
+)
+
+// resources that are not participants or assets, named after the Composer transactions they port
+const (
+	ResourceCreateProductListing = "createProductListing"
+	ResourceTransferListing      = "transferListing"
+	ResourceCheckProducts        = "checkProducts"
+	ResourceUpdateExemptedList   = "updateExemptedList"
+	ResourceLedger               = "Ledger"   // raw keys, see write() and delete()
+	ResourceFunction             = "Function" // a function with no requests of its own, denied unless in allow mode
+)
+
+const (
+	aclModeKey   = "acl_mode"
+	AclModeDeny  = "deny"
+	AclModeAllow = "allow"
+)
+
+// resource type of the User records init_user creates, by role
+var userResources = map[string]string{
+	RoleSupplier: "Supplier",
+	RoleImporter: "Importer",
+	RoleRetailer: "Retailer",
+	RoleBroker:   "Broker",
+}
+
+type AclRequest struct {
+	ParticipantId   string
+	ParticipantType string // caller's role, see roles.go
+	Operation       string
+	Resource        string // Supplier, ProductListingContract, transferListing...
+	ResourceId      string
+	Owner           string // listing or consignment holder, or the participant a record belongs to
+	Supplier        string // supplier creating a listing
+	Regulator       string // regulator a transaction is made in the name of
+	Transaction     string // transaction an update is made by
+}
+
+type AclRule struct {
+	Name        string
+	Description string
+	Participant string // role or ANY
+	Operation   string
+	Resource    string // resource type or ANY
+	Transaction string // only while running this transaction, if set
+	Condition   func(request AclRequest) bool
+	Action      string
+}
+
+// ============================================================================================================================
+// Conditions - the condition expressions of permissions.acl
+// ============================================================================================================================
+func is_own_record(request AclRequest) bool {
+	return len(request.ResourceId) > 0 && request.ResourceId == request.ParticipantId
+}
+
+func is_resource_owner(request AclRequest) bool {
+	return len(request.Owner) > 0 && request.Owner == request.ParticipantId
+}
+
+func is_listing_supplier(request AclRequest) bool {
+	return len(request.Supplier) > 0 && request.Supplier == request.ParticipantId
+}
+
+func is_named_regulator(request AclRequest) bool {
+	return len(request.Regulator) > 0 && request.Regulator == request.ParticipantId
+}
+
+// ============================================================================================================================
+// Rule table - permissions.acl in order, then the rules for functions the Composer network did not have
+// ============================================================================================================================
+var aclRules = []AclRule{
+	{"SupplierView", "Allow supplier read access to all importer resources",
+		RoleSupplier, AclRead, "Importer", "", nil, AclAllow},
+	{"SupplierCanViewOwnData", "Allow supplier access to his own data",
+		RoleSupplier, AclAll, "Supplier", "", is_own_record, AclAllow},
+	{"ImporterCanViewRetailerData", "Allow importer read access to Retailer resources",
+		RoleImporter, AclRead, "Retailer", "", nil, AclAllow},
+	{"ImporterCanViewRegulatorData", "Allow importer read access to Regulator resources",
+		RoleImporter, AclRead, "Regulator", "", nil, AclAllow},
+	{"ImporterCanSupplierDataView", "Allow importer read access to Supplier resources",
+		RoleImporter, AclRead, "Supplier", "", nil, AclAllow},
+	{"ImporterCanViewOwnData", "Allow importer access to his own data",
+		RoleImporter, AclAll, "Importer", "", is_own_record, AclAllow},
+	{"RetailerView", "Allow retailer read access to all importer resources",
+		RoleRetailer, AclRead, "Importer", "", nil, AclAllow},
+	{"RetailerCanViewOwnData", "Allow retailer access to his own data",
+		RoleRetailer, AclAll, "Retailer", "", is_own_record, AclAllow},
+	{"RegulatorView", "Allow regulator read access to all resources",
+		RoleRegulator, AclRead, AclAny, "", nil, AclAllow},
+	{"CreateProductListing", "Allow Supplier to create new product listing",
+		RoleSupplier, AclCreate, ResourceCreateProductListing, "", is_listing_supplier, AclAllow},
+	{"ProductListingOwner", "Allow the owner of a product listing total access to their listing",
+		AclAny, AclAll, "ProductListingContract", "", is_resource_owner, AclAllow},
+	{"TransferListing", "Allow the owner of a product listing to transfer the listing",
+		AclAny, AclCreate, ResourceTransferListing, "", is_resource_owner, AclAllow},
+	{"TransferListingUpdateRetailerProducts", "Allow the owner of a product listing to update the retailer it is transferred to",
+		AclAny, AclUpdate, "Retailer", ResourceTransferListing, is_resource_owner, AclAllow},
+	{"CheckProducts", "Allow the importer holding a product listing to have its products checked",
+		RoleImporter, AclCreate, ResourceCheckProducts, "", is_resource_owner, AclAllow},
+	{"UpdateExemptedList", "Allow a regulator to update its exempted list",
+		RoleRegulator, AclCreate, ResourceUpdateExemptedList, "", is_named_regulator, AclAllow},
+
+	// chaincode only
+	{"RegulatorCanManageOwnData", "Allow regulator access to his own data",
+		RoleRegulator, AclAll, "Regulator", "", is_own_record, AclAllow},
+	{"RegulatorChecksProducts", "Allow a regulator to check products in its own name",
+		RoleRegulator, AclCreate, ResourceCheckProducts, "", is_named_regulator, AclAllow},
+	{"RegulatorReviewsListings", "Allow a regulator to update listings it checks, reviews or rejects",
+		RoleRegulator, AclUpdate, "ProductListingContract", "", is_named_regulator, AclAllow},
+	{"RegulatorReviewsConsignments", "Allow a regulator to update consignments it checks",
+		RoleRegulator, AclUpdate, "Consignment", "", is_named_regulator, AclAllow},
+	{"RegulatorReviewsHazardAnalysis", "Allow a regulator to approve or reject hazard analysis reports",
+		RoleRegulator, AclUpdate, "HazardAnalysisReport", "", is_named_regulator, AclAllow},
+	{"SupplierCreateProduct", "Allow supplier to create products",
+		RoleSupplier, AclCreate, "Product", "", nil, AclAllow},
+	{"ViewProducts", "Allow participants read access to products",
+		AclAny, AclRead, "Product", "", nil, AclAllow},
+	{"HazardAnalysisOwner", "Allow the holder of a listing to file its hazard analysis",
+		AclAny, AclAll, "HazardAnalysisReport", "", is_resource_owner, AclAllow},
+	{"ConsignmentOwner", "Allow the importer of a consignment total access to it",
+		AclAny, AclAll, "Consignment", "", is_resource_owner, AclAllow},
+	{"ListingSupplierView", "Allow supplier read access to the listings it created",
+		RoleSupplier, AclRead, "ProductListingContract", "", is_listing_supplier, AclAllow},
+	{"RegulatorManagesExemptions", "Allow a regulator to update the exemptions of its country",
+		RoleRegulator, AclUpdate, "Jurisdiction", "", is_named_regulator, AclAllow},
+	{"ViewExemptions", "Allow participants read access to the exemptions in force in each country",
+		AclAny, AclRead, "Jurisdiction", "", nil, AclAllow},
+	{"BrokerCanViewOwnData", "Allow broker access to his own data",
+		RoleBroker, AclAll, "Broker", "", is_own_record, AclAllow},
+	{"RegulatorSuspendsParticipants", "Allow a regulator to suspend and reinstate participants in its own name",
+		RoleRegulator, AclAll, "Suspension", "", is_named_regulator, AclAllow},
+	{"SuspensionSubjectView", "Allow participants read access to their own suspension history",
+		AclAny, AclRead, "Suspension", "", is_resource_owner, AclAllow},
+	{"ImporterManagesDelegations", "Allow an importer to grant, revoke and view its delegations to brokers",
+		RoleImporter, AclAll, "Delegation", "", is_resource_owner, AclAllow},
+}
+
+var aclDefaultRule = AclRule{"Default", "Allow all participants access to all resources",
+	AclAny, AclAll, AclAny, "", nil, AclAllow}
+
+// ============================================================================================================================
+// Rule evaluation
+// ============================================================================================================================
+func (rule AclRule) matches(request AclRequest) bool {
+	if rule.Participant != AclAny && rule.Participant != request.ParticipantType {
+		return false
+	}
+	if rule.Operation != AclAll && rule.Operation != request.Operation {
+		return false
+	}
+	if rule.Resource != AclAny && rule.Resource != request.Resource {
+		return false
+	}
+	if len(rule.Transaction) > 0 && rule.Transaction != request.Transaction {
+		return false
+	}
+	return rule.Condition == nil || rule.Condition(request)
+}
+
+func acl_rules(mode string) []AclRule {
+	if mode == AclModeAllow {
+		return append(append([]AclRule{}, aclRules...), aclDefaultRule)
+	}
+	return aclRules
+}
+
+// ============================================================================================================================
+// evaluate_acl() - the first rule matching the request decides, no match denies
+// ============================================================================================================================
+func evaluate_acl(rules []AclRule, request AclRequest) (bool, string) {
+	for _, rule := range rules {
+		if rule.matches(request) {
+			return rule.Action == AclAllow, rule.Name
+		}
+	}
+	return false, ""
+}
+
+func get_acl_mode(stub shim.ChaincodeStubInterface) (string, error) {
+	modeAsBytes, err := stub.GetState(aclModeKey)
+	if err != nil {
+		return "", err
+	}
+	if string(modeAsBytes) == AclModeAllow {
+		return AclModeAllow, nil
+	}
+	return AclModeDeny, nil
+}
+
+// ============================================================================================================================
+// describe_record() - request for an operation on a stored entity, with its resource type and who it belongs to
+//
+// With no namespace the id is a plain ledger key, see read() and write().
+// ============================================================================================================================
+func describe_record(stub shim.ChaincodeStubInterface, operation string, namespace string, id string) AclRequest {
+	request := AclRequest{Operation: operation, Resource: ResourceLedger, ResourceId: id}
+	if len(namespace) == 0 {
+		return request
+	}
+	var record map[string]json.RawMessage
+	recordAsBytes, err := get_entity_state(stub, namespace, id)
+	if err != nil || json.Unmarshal(recordAsBytes, &record) != nil {
+		return request
+	}
+	return describe_entity(request, namespace, record)
+}
+
+// ============================================================================================================================
+// describe_entity() - fill in a request's resource type and owner from the entity it is about
+// ============================================================================================================================
+func describe_entity(request AclRequest, namespace string, record map[string]json.RawMessage) AclRequest {
+	switch namespace {
+	case listingNamespace:
+		request.Resource = "ProductListingContract"
+		json.Unmarshal(record["owner"], &request.Owner)
+		json.Unmarshal(record["supplier"], &request.Supplier)
+	case hazardReportNamespace:
+		request.Resource = "HazardAnalysisReport"
+		json.Unmarshal(record["importerId"], &request.Owner)
+	case consignmentNamespace:
+		request.Resource = "Consignment"
+		json.Unmarshal(record["importerId"], &request.Owner)
+	case productNamespace:
+		request.Resource = "Product"
+	case participantNamespace:
+		var userType string
+		json.Unmarshal(record["Type"], &userType)
+		if resource, ok := userResources[userType]; ok {
+			request.Resource = resource
+		} else {
+			request.Resource = "Regulator"
+		}
+		request.Owner = request.ResourceId
+	}
+	return request
+}
+
+// ============================================================================================================================
+// acl_requests() - what a function is about to do, as requests to check against the rule table
+//
+// Records the function works on are looked up here only to find their owners. If one is missing no request is made
+// for it and the function reports the error itself. A function with no case is one request no rule allows.
+// ============================================================================================================================
+func acl_requests(stub shim.ChaincodeStubInterface, function string, args []string, callerRole string) []AclRequest {
+	args = document_arguments(function, args) // an init_* document, as the positional arguments it replaces
+	arg := func(i int) string {
+		if i < len(args) {
+			return args[i]
+		}
+		return ""
+	}
+	listing := func(operation string, id string) []AclRequest {
+		productListing, err := get_product_listing(stub, id)
+		if err != nil {
+			return nil
+		}
+		return []AclRequest{{Operation: operation, Resource: "ProductListingContract", ResourceId: id, Owner: productListing.Owner,
+			Supplier: productListing.Supplier}}
+	}
+
+	switch function {
+	case "delete":
+		return []AclRequest{{Operation: AclUpdate, Resource: ResourceLedger, ResourceId: arg(0)}}
+	case "read":
+		if len(args) == 2 {
+			return []AclRequest{describe_record(stub, AclRead, arg(0), arg(1))}
+		}
+		return []AclRequest{describe_record(stub, AclRead, "", arg(0))}
+	case "getHistory":
+		return []AclRequest{describe_record(stub, AclRead, productNamespace, arg(0))}
+	case "get_user":
+		return []AclRequest{describe_record(stub, AclRead, participantNamespace, arg(0))}
+	case "rotate_identity", "update_user":
+		return []AclRequest{describe_record(stub, AclUpdate, participantNamespace, arg(0))}
+	case "read_everything", "query":
+		return nil // returns only the records the caller can read, see new_read_filter()
+	case "get_caller_role", "get_schema":
+		return nil // the caller's own role, and the schemas every participant validates against
+	case "init_product":
+		return []AclRequest{{Operation: AclCreate, Resource: "Product", ResourceId: arg(0)}}
+	case "init_user":
+		resource, ok := userResources[callerRole]
+		if !ok {
+			resource = ResourceLedger
+		}
+		return []AclRequest{{Operation: AclCreate, Resource: resource, ResourceId: arg(0), Owner: arg(0)}}
+	case "init_regulator":
+		return []AclRequest{{Operation: AclCreate, Resource: "Regulator", ResourceId: arg(0), Owner: arg(0)}}
+	case "init_product_listing":
+		return []AclRequest{
+			{Operation: AclCreate, Resource: ResourceCreateProductListing, Supplier: arg(1)},
+			{Operation: AclCreate, Resource: "ProductListingContract", ResourceId: arg(0), Owner: arg(1)},
+		}
+	case "transfer_product_listing":
+		productListing, err := get_product_listing(stub, arg(0))
+		if err != nil {
+			return nil
+		}
+		requests := []AclRequest{
+			{Operation: AclCreate, Resource: ResourceTransferListing, ResourceId: productListing.Id, Owner: productListing.Owner},
+			{Operation: AclUpdate, Resource: "ProductListingContract", ResourceId: productListing.Id, Owner: productListing.Owner},
+		}
+		if strings.ToLower(productListing.OwnerType) == RoleImporter {
+			requests = append(requests, AclRequest{Operation: AclUpdate, Resource: "Retailer", ResourceId: arg(1),
+				Owner: productListing.Owner, Transaction: ResourceTransferListing})
+		}
+		return requests
+	case "check_products":
+		namespace := listingNamespace
+		if _, err := get_consignment(stub, arg(0)); err == nil {
+			namespace = consignmentNamespace
+		}
+		checked := describe_record(stub, AclUpdate, namespace, arg(0))
+		checked.Regulator = arg(1)
+		return []AclRequest{
+			{Operation: AclCreate, Resource: ResourceCheckProducts, ResourceId: arg(0), Owner: checked.Owner, Regulator: arg(1)},
+			checked,
+		}
+	case "update_exempted_list":
+		return []AclRequest{
+			{Operation: AclCreate, Resource: ResourceUpdateExemptedList, Regulator: arg(0)},
+			{Operation: AclUpdate, Resource: "Jurisdiction", Regulator: arg(0)},
+		}
+	case "submit_hazard_analysis":
+		requests := listing(AclUpdate, arg(1))
+		if requests == nil {
+			return nil
+		}
+		return append(requests, AclRequest{Operation: AclCreate, Resource: "HazardAnalysisReport", ResourceId: arg(0), Owner: requests[0].Owner})
+	case "approve_hazard_analysis", "reject_hazard_analysis":
+		report, err := get_hazard_report(stub, arg(0))
+		if err != nil {
+			return nil
+		}
+		return []AclRequest{
+			{Operation: AclUpdate, Resource: "HazardAnalysisReport", ResourceId: report.Id, Owner: report.ImporterId, Regulator: arg(1)},
+			{Operation: AclUpdate, Resource: "ProductListingContract", ResourceId: report.ListingId, Regulator: arg(1)},
+		}
+	case "set_risk_policy":
+		return []AclRequest{{Operation: AclUpdate, Resource: "Jurisdiction", Regulator: arg(0)}}
+	case "sign_off_listing":
+		requests := listing(AclUpdate, arg(0))
+		for i := range requests {
+			requests[i].Regulator = arg(1)
+		}
+		return requests
+	case "reject_listing":
+		requests := listing(AclUpdate, arg(0))
+		for i := range requests {
+			requests[i].Regulator = arg(1)
+		}
+		return requests
+	case "record_disposition":
+		return listing(AclUpdate, arg(0))
+	case "split_product_listing":
+		requests := listing(AclUpdate, arg(0))
+		if requests == nil {
+			return nil
+		}
+		return append(requests, AclRequest{Operation: AclCreate, Resource: "ProductListingContract", Owner: requests[0].Owner})
+	case "init_consignment":
+		requests := []AclRequest{{Operation: AclCreate, Resource: "Consignment", ResourceId: arg(0), Owner: arg(1)}}
+		for i := 2; i < len(args); i++ {
+			requests = append(requests, listing(AclUpdate, args[i])...)
+		}
+		return requests
+	case "sell_product", "dispose_product", "write_off_product":
+		return []AclRequest{{Operation: AclUpdate, Resource: "Retailer", ResourceId: arg(0)}}
+	case "get_listing_totals", "get_listing_transitions", "get_listing_lineage":
+		if len(args) == 0 {
+			return nil
+		}
+		return listing(AclRead, arg(0))
+	case "grant_delegation":
+		return []AclRequest{{Operation: AclCreate, Resource: "Delegation", ResourceId: arg(1), Owner: arg(0)}}
+	case "revoke_delegation":
+		return []AclRequest{{Operation: AclUpdate, Resource: "Delegation", ResourceId: arg(1), Owner: arg(0)}}
+	case "get_delegations", "get_delegated_actions":
+		return []AclRequest{{Operation: AclRead, Resource: "Delegation", Owner: arg(0)}}
+	case "suspend_participant", "reinstate_participant":
+		return []AclRequest{{Operation: AclCreate, Resource: "Suspension", ResourceId: arg(0), Owner: arg(0), Regulator: arg(1)}}
+	case "get_suspension_history":
+		return []AclRequest{{Operation: AclRead, Resource: "Suspension", ResourceId: arg(0), Owner: arg(0)}}
+	case "get_exemptions":
+		return []AclRequest{{Operation: AclRead, Resource: "Jurisdiction", ResourceId: arg(0)}}
+	case "get_retailer_totals", "get_expiring_products", "get_stock_ledger":
+		return []AclRequest{{Operation: AclRead, Resource: "Retailer", ResourceId: arg(0)}}
+	}
+	// deny by default, a function must be described above before participants can call it
+	return []AclRequest{{Operation: AclInvoke, Resource: ResourceFunction, ResourceId: function}}
+}
+
+// ============================================================================================================================
+// check_acl() - refuse the function unless every request it makes is allowed, called from Invoke() before dispatching
+//
+// A request the caller is denied is allowed if the record's owner delegated the function to the caller and would be
+// allowed itself, see delegation.go.
+// ============================================================================================================================
+func check_acl(stub shim.ChaincodeStubInterface, function string, args []string) error {
+	mode, err := get_acl_mode(stub)
+	if err != nil {
+		return err
+	}
+	caller, err := read_caller_role(stub)
+	if err != nil {
+		return err
+	}
+
+	requests := acl_requests(stub, function, args, caller.Role)
+	rules := acl_rules(mode)
+	for _, request := range requests {
+		request.ParticipantId = caller.Id
+		request.ParticipantType = caller.Role
+		allowed, _ := evaluate_acl(rules, request)
+		if !allowed && len(request.Owner) > 0 && request.Owner != caller.Id {
+			allowed = allowed_as_principal(stub, rules, request, function)
+		}
+		if !allowed {
+			resource := request.Resource
+			if len(request.ResourceId) > 0 {
+				resource += " " + request.ResourceId
+			}
+			return errors.New("Access denied - " + caller.Id + " cannot " + strings.ToLower(request.Operation) + " " + resource)
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// allowed_as_principal() - whether an agent's request is allowed to the owner that delegated function to it
+// ============================================================================================================================
+func allowed_as_principal(stub shim.ChaincodeStubInterface, rules []AclRule, request AclRequest, function string) bool {
+	_, err := check_delegation(stub, request.Owner, request.ParticipantId, function)
+	if err != nil {
+		return false
+	}
+	principal, err := get_user(stub, request.Owner)
+	if err != nil {
+		return false
+	}
+	request.ParticipantId = request.Owner
+	request.ParticipantType = principal.Type
+	allowed, _ := evaluate_acl(rules, request)
+	return allowed
+}
+
+// ============================================================================================================================
+// new_read_filter() - for reads returning many records, reports whether the caller may read each one
+// ============================================================================================================================
+func new_read_filter(stub shim.ChaincodeStubInterface) (func(request AclRequest) bool, error) {
+	mode, err := get_acl_mode(stub)
+	if err != nil {
+		return nil, err
+	}
+	caller, err := read_caller_role(stub)
+	if err != nil {
+		return nil, err
+	}
+	rules := acl_rules(mode)
+
+	return func(request AclRequest) bool {
+		request.ParticipantId = caller.Id
+		request.ParticipantType = caller.Role
+		request.Operation = AclRead
+		allowed, _ := evaluate_acl(rules, request)
+		return allowed
+	}, nil
+}
@@ -0,0 +1,249 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// outcomes of permissions.acl without its Default rule, ie deny mode
+var aclCases = []struct {
+	name    string
+	request AclRequest
+	allowed bool
+	rule    string
+}{
+	{"supplier reads importer",
+		AclRequest{ParticipantId: "supplier1", ParticipantType: RoleSupplier, Operation: AclRead, Resource: "Importer", ResourceId: "importer1"},
+		true, "SupplierView"},
+	{"supplier reads retailer",
+		AclRequest{ParticipantId: "supplier1", ParticipantType: RoleSupplier, Operation: AclRead, Resource: "Retailer", ResourceId: "retailer1"},
+		false, ""},
+	{"supplier updates own record",
+		AclRequest{ParticipantId: "supplier1", ParticipantType: RoleSupplier, Operation: AclUpdate, Resource: "Supplier", ResourceId: "supplier1"},
+		true, "SupplierCanViewOwnData"},
+	{"supplier reads another supplier",
+		AclRequest{ParticipantId: "supplier1", ParticipantType: RoleSupplier, Operation: AclRead, Resource: "Supplier", ResourceId: "supplier2"},
+		false, ""},
+	{"importer reads retailer",
+		AclRequest{ParticipantId: "importer1", ParticipantType: RoleImporter, Operation: AclRead, Resource: "Retailer", ResourceId: "retailer1"},
+		true, "ImporterCanViewRetailerData"},
+	{"importer updates retailer",
+		AclRequest{ParticipantId: "importer1", ParticipantType: RoleImporter, Operation: AclUpdate, Resource: "Retailer", ResourceId: "retailer1"},
+		false, ""},
+	{"importer reads regulator",
+		AclRequest{ParticipantId: "importer1", ParticipantType: RoleImporter, Operation: AclRead, Resource: "Regulator", ResourceId: "regulator1"},
+		true, "ImporterCanViewRegulatorData"},
+	{"importer reads supplier",
+		AclRequest{ParticipantId: "importer1", ParticipantType: RoleImporter, Operation: AclRead, Resource: "Supplier", ResourceId: "supplier1"},
+		true, "ImporterCanSupplierDataView"},
+	{"importer deletes own record",
+		AclRequest{ParticipantId: "importer1", ParticipantType: RoleImporter, Operation: AclDelete, Resource: "Importer", ResourceId: "importer1"},
+		true, "ImporterCanViewOwnData"},
+	{"importer reads another importer",
+		AclRequest{ParticipantId: "importer1", ParticipantType: RoleImporter, Operation: AclRead, Resource: "Importer", ResourceId: "importer2"},
+		false, ""},
+	{"retailer reads importer",
+		AclRequest{ParticipantId: "retailer1", ParticipantType: RoleRetailer, Operation: AclRead, Resource: "Importer", ResourceId: "importer1"},
+		true, "RetailerView"},
+	{"retailer reads supplier",
+		AclRequest{ParticipantId: "retailer1", ParticipantType: RoleRetailer, Operation: AclRead, Resource: "Supplier", ResourceId: "supplier1"},
+		false, ""},
+	{"retailer updates own record",
+		AclRequest{ParticipantId: "retailer1", ParticipantType: RoleRetailer, Operation: AclUpdate, Resource: "Retailer", ResourceId: "retailer1"},
+		true, "RetailerCanViewOwnData"},
+	{"retailer reads another retailer",
+		AclRequest{ParticipantId: "retailer1", ParticipantType: RoleRetailer, Operation: AclRead, Resource: "Retailer", ResourceId: "retailer2"},
+		false, ""},
+	{"regulator reads listing",
+		AclRequest{ParticipantId: "regulator1", ParticipantType: RoleRegulator, Operation: AclRead, Resource: "ProductListingContract", ResourceId: "l1", Owner: "importer1"},
+		true, "RegulatorView"},
+	{"regulator updates supplier",
+		AclRequest{ParticipantId: "regulator1", ParticipantType: RoleRegulator, Operation: AclUpdate, Resource: "Supplier", ResourceId: "supplier1"},
+		false, ""},
+	{"supplier creates own listing",
+		AclRequest{ParticipantId: "supplier1", ParticipantType: RoleSupplier, Operation: AclCreate, Resource: ResourceCreateProductListing, Supplier: "supplier1"},
+		true, "CreateProductListing"},
+	{"supplier creates listing for another supplier",
+		AclRequest{ParticipantId: "supplier1", ParticipantType: RoleSupplier, Operation: AclCreate, Resource: ResourceCreateProductListing, Supplier: "supplier2"},
+		false, ""},
+	{"importer creates listing",
+		AclRequest{ParticipantId: "importer1", ParticipantType: RoleImporter, Operation: AclCreate, Resource: ResourceCreateProductListing, Supplier: "importer1"},
+		false, ""},
+	{"owner updates listing",
+		AclRequest{ParticipantId: "importer1", ParticipantType: RoleImporter, Operation: AclUpdate, Resource: "ProductListingContract", ResourceId: "l1", Owner: "importer1"},
+		true, "ProductListingOwner"},
+	{"non owner reads listing",
+		AclRequest{ParticipantId: "retailer1", ParticipantType: RoleRetailer, Operation: AclRead, Resource: "ProductListingContract", ResourceId: "l1", Owner: "importer1"},
+		false, ""},
+	{"supplier reads a listing it created",
+		AclRequest{ParticipantId: "supplier1", ParticipantType: RoleSupplier, Operation: AclRead, Resource: "ProductListingContract", ResourceId: "l1", Owner: "importer1", Supplier: "supplier1"},
+		true, "ListingSupplierView"},
+	{"supplier reads another supplier's listing",
+		AclRequest{ParticipantId: "supplier2", ParticipantType: RoleSupplier, Operation: AclRead, Resource: "ProductListingContract", ResourceId: "l1", Owner: "importer1", Supplier: "supplier1"},
+		false, ""},
+	{"owner transfers listing",
+		AclRequest{ParticipantId: "supplier1", ParticipantType: RoleSupplier, Operation: AclCreate, Resource: ResourceTransferListing, ResourceId: "l1", Owner: "supplier1"},
+		true, "TransferListing"},
+	{"non owner transfers listing",
+		AclRequest{ParticipantId: "importer1", ParticipantType: RoleImporter, Operation: AclCreate, Resource: ResourceTransferListing, ResourceId: "l1", Owner: "supplier1"},
+		false, ""},
+	{"owner updates retailer while transferring",
+		AclRequest{ParticipantId: "importer1", ParticipantType: RoleImporter, Operation: AclUpdate, Resource: "Retailer", ResourceId: "retailer1", Owner: "importer1", Transaction: ResourceTransferListing},
+		true, "TransferListingUpdateRetailerProducts"},
+	{"non owner updates retailer while transferring",
+		AclRequest{ParticipantId: "importer2", ParticipantType: RoleImporter, Operation: AclUpdate, Resource: "Retailer", ResourceId: "retailer1", Owner: "importer1", Transaction: ResourceTransferListing},
+		false, ""},
+	{"holding importer checks products",
+		AclRequest{ParticipantId: "importer1", ParticipantType: RoleImporter, Operation: AclCreate, Resource: ResourceCheckProducts, ResourceId: "l1", Owner: "importer1"},
+		true, "CheckProducts"},
+	{"other importer checks products",
+		AclRequest{ParticipantId: "importer2", ParticipantType: RoleImporter, Operation: AclCreate, Resource: ResourceCheckProducts, ResourceId: "l1", Owner: "importer1"},
+		false, ""},
+	{"regulator updates own exempted list",
+		AclRequest{ParticipantId: "regulator1", ParticipantType: RoleRegulator, Operation: AclCreate, Resource: ResourceUpdateExemptedList, Regulator: "regulator1"},
+		true, "UpdateExemptedList"},
+	{"regulator updates another regulator's exempted list",
+		AclRequest{ParticipantId: "regulator1", ParticipantType: RoleRegulator, Operation: AclCreate, Resource: ResourceUpdateExemptedList, Regulator: "regulator2"},
+		false, ""},
+	{"caller without a role writes a raw key",
+		AclRequest{ParticipantId: "user1", Operation: AclUpdate, Resource: ResourceLedger, ResourceId: "selftest"},
+		false, ""},
+}
+
+func TestAclDenyMode(t *testing.T) {
+	rules := acl_rules(AclModeDeny)
+	for _, c := range aclCases {
+		allowed, rule := evaluate_acl(rules, c.request)
+		if allowed != c.allowed || rule != c.rule {
+			t.Errorf("%s: got allowed=%v by %q, want allowed=%v by %q", c.name, allowed, rule, c.allowed, c.rule)
+		}
+	}
+}
+
+// permissions.acl ends with a Default rule allowing everything
+func TestAclAllowMode(t *testing.T) {
+	rules := acl_rules(AclModeAllow)
+	for _, c := range aclCases {
+		allowed, rule := evaluate_acl(rules, c.request)
+		if !allowed {
+			t.Errorf("%s: denied in allow mode", c.name)
+		}
+		if c.allowed && rule != c.rule {
+			t.Errorf("%s: allowed by %q, want %q", c.name, rule, c.rule)
+		}
+		if !c.allowed && rule != "Default" {
+			t.Errorf("%s: allowed by %q, want Default", c.name, rule)
+		}
+	}
+	if len(acl_rules(AclModeDeny)) != len(aclRules) {
+		t.Error("allow mode changed the deny mode rule table")
+	}
+}
+
+// every composer.food.supply rule of permissions.acl is ported, in the same order
+func TestAclRulesPorted(t *testing.T) {
+	ported := []string{
+		"SupplierView", "SupplierCanViewOwnData", "ImporterCanViewRetailerData", "ImporterCanViewRegulatorData",
+		"ImporterCanSupplierDataView", "ImporterCanViewOwnData", "RetailerView", "RetailerCanViewOwnData",
+		"RegulatorView", "CreateProductListing", "ProductListingOwner", "TransferListing",
+		"TransferListingUpdateRetailerProducts", "CheckProducts", "UpdateExemptedList",
+	}
+	for i, name := range ported {
+		if i >= len(aclRules) || aclRules[i].Name != name {
+			t.Fatalf("rule %d should be %s", i, name)
+		}
+	}
+}
+
+// a function acl_requests() does not describe is refused, not let through with no requests
+func TestAclUnmappedFunction(t *testing.T) {
+	for _, role := range []string{RoleSupplier, RoleImporter, RoleRetailer, RoleBroker, RoleRegulator} {
+		requests := acl_requests(nil, "unmapped_function", nil, role)
+		if len(requests) == 0 {
+			t.Fatalf("%s: unmapped function made no requests", role)
+		}
+		for _, request := range requests {
+			request.ParticipantId = role + "1"
+			request.ParticipantType = role
+			if allowed, rule := evaluate_acl(acl_rules(AclModeDeny), request); allowed {
+				t.Errorf("%s: unmapped function allowed by %q in deny mode", role, rule)
+			}
+			if allowed, _ := evaluate_acl(acl_rules(AclModeAllow), request); !allowed {
+				t.Errorf("%s: unmapped function denied in allow mode", role)
+			}
+		}
+	}
+	if requests := acl_requests(nil, "get_schema", nil, RoleSupplier); len(requests) != 0 {
+		t.Errorf("get_schema should make no requests, got %v", requests)
+	}
+}
+
+// world state only, enough for acl_requests() to look up the records a function works on
+type aclStateStub struct {
+	shim.ChaincodeStubInterface
+	state map[string][]byte
+}
+
+func (stub aclStateStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return "\x00" + objectType + "\x00" + strings.Join(attributes, "\x00") + "\x00", nil
+}
+
+func (stub aclStateStub) GetState(key string) ([]byte, error) {
+	return stub.state[key], nil
+}
+
+// the supplier of a listing held by an importer reads it through the listing functions as it does through read
+func TestAclListingSupplierRequests(t *testing.T) {
+	stub := aclStateStub{state: map[string][]byte{}}
+	listing := ProductListingContract{Id: "l1", Status: StatusExemptCheckReq, Owner: "importer1", OwnerType: "Importer", Supplier: "supplier1"}
+	listingAsBytes, _ := json.Marshal(listing)
+	key, _ := stub.CreateCompositeKey(listingNamespace, []string{"l1"})
+	stub.state[key] = listingAsBytes
+
+	rules := acl_rules(AclModeDeny)
+	for _, function := range []string{"get_listing_totals", "get_listing_transitions", "get_listing_lineage"} {
+		for _, c := range []struct {
+			caller  string
+			role    string
+			allowed bool
+		}{
+			{"supplier1", RoleSupplier, true},
+			{"supplier2", RoleSupplier, false},
+			{"retailer1", RoleRetailer, false},
+		} {
+			requests := acl_requests(stub, function, []string{"l1"}, c.role)
+			if len(requests) == 0 {
+				t.Fatalf("%s: no requests", function)
+			}
+			for _, request := range requests {
+				request.ParticipantId = c.caller
+				request.ParticipantType = c.role
+				if allowed, rule := evaluate_acl(rules, request); allowed != c.allowed {
+					t.Errorf("%s by %s: got allowed=%v by %q, want %v", function, c.caller, allowed, rule, c.allowed)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,267 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Administrator - who may run the maintenance functions
+//
+// The administrator is set when the chaincode is instantiated: the identity that instantiates it, or the one named in
+// Init()'s third argument. Only the administrator can re-run init or use the generic write, and every time it does an
+// AdminAuditEntry is recorded under adminaudit~timestamp~txid.
+//
+// Protected keys - the chaincode's own settings (selftest, food_reg_ui, acl_mode) and every composite key (indexes,
+// logs, delegations, jurisdictions, the administrator itself) - cannot be written by write() or used as the id of
+// anything a write function creates.
+// ============================================================================================================================
+
+const (
+	adminIndex      = "admin"
+	adminAuditIndex = "adminaudit"
+)
+
+// functions only the administrator may invoke, and whether they change state
+var adminFunctions = map[string]bool{
+	"init":             true,
+	"write":            true,
+	"migrate_keys":     true,
+	"confirm_identity": true,
+	"get_admin_audit":  false,
+}
+
+// plain keys the chaincode keeps its settings under
+var reservedKeys = []string{"selftest", "food_reg_ui", aclModeKey}
+
+func is_admin_function(function string) bool {
+	_, ok := adminFunctions[function]
+	return ok
+}
+
+// ============================================================================================================================
+// is_protected_key() - settings and composite keys, which begin with U+0000
+// ============================================================================================================================
+func is_protected_key(key string) bool {
+	return strings.HasPrefix(key, "\x00") || contains_string(reservedKeys, key)
+}
+
+// ============================================================================================================================
+// check_protected_keys() - refuse writes naming a protected key, called from Invoke() before dispatching
+// ============================================================================================================================
+func check_protected_keys(function string, args []string) error {
+	if function == "write" && len(args) > 0 {
+		args = args[:1] // the key, not the value
+	} else if !is_role_checked(function) {
+		return nil
+	}
+	args = document_arguments(function, args) // the ids in an init_* document
+	for _, arg := range args {
+		if is_protected_key(arg) {
+			return errors.New("Key " + strings.Replace(arg, "\x00", "~", -1) + " is protected and cannot be written by " + function)
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// get_admin() - the administrator, nil if none has been set
+// ============================================================================================================================
+func get_admin(stub shim.ChaincodeStubInterface) (*Administrator, error) {
+	adminKey, err := stub.CreateCompositeKey(adminIndex, []string{})
+	if err != nil {
+		return nil, err
+	}
+	adminAsBytes, err := stub.GetState(adminKey)
+	if err != nil {
+		return nil, errors.New("Failed to get administrator")
+	}
+	if adminAsBytes == nil {
+		return nil, nil
+	}
+	var admin Administrator
+	err = json.Unmarshal(adminAsBytes, &admin)
+	if err != nil {
+		return nil, err
+	}
+	return &admin, nil
+}
+
+// ============================================================================================================================
+// set_admin() - called from Init(), keeps the current administrator unless one is named
+//
+// With no administrator yet the identity running Init() becomes it.
+// ============================================================================================================================
+func set_admin(stub shim.ChaincodeStubInterface, adminId string) (*Administrator, error) {
+	admin, err := get_admin(stub)
+	if err != nil {
+		return nil, err
+	}
+	if admin != nil && len(adminId) == 0 {
+		return admin, nil
+	}
+
+	_, commonName, err := read_caller_certificate(stub)
+	if err != nil {
+		return nil, err
+	}
+	mspId, err := cid.GetMSPID(stub)
+	if err != nil {
+		return nil, errors.New("Could not read the caller's MSP - " + err.Error())
+	}
+	if len(adminId) == 0 {
+		adminId = commonName
+	}
+	admin = &Administrator{Id: adminId, MSPId: mspId, SetTxId: stub.GetTxID()}
+
+	adminKey, err := stub.CreateCompositeKey(adminIndex, []string{})
+	if err != nil {
+		return nil, err
+	}
+	adminAsBytes, _ := json.Marshal(admin)
+	return admin, stub.PutState(adminKey, adminAsBytes)
+}
+
+// ============================================================================================================================
+// is_admin() - whether the transaction was signed by the administrator
+// ============================================================================================================================
+func is_admin(stub shim.ChaincodeStubInterface) (bool, error) {
+	admin, err := get_admin(stub)
+	if err != nil || admin == nil {
+		return false, err
+	}
+	_, commonName, err := read_caller_certificate(stub)
+	if err != nil {
+		return false, err
+	}
+	mspId, err := cid.GetMSPID(stub)
+	if err != nil {
+		return false, errors.New("Could not read the caller's MSP - " + err.Error())
+	}
+	return commonName == admin.Id && mspId == admin.MSPId, nil
+}
+
+// ============================================================================================================================
+// check_admin() - refuse an admin function unless the administrator invoked it, and audit the ones that change state,
+// called from Invoke() in place of the role and access control checks
+//
+// init is audited by Init() itself, which also runs on instantiate and upgrade.
+// ============================================================================================================================
+func check_admin(stub shim.ChaincodeStubInterface, function string, args []string) error {
+	admin, err := get_admin(stub)
+	if err != nil {
+		return err
+	}
+	if admin == nil {
+		return errors.New("No administrator has been set, upgrade the chaincode to set one before invoking " + function)
+	}
+	ok, err := is_admin(stub)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("Only the administrator can invoke " + function)
+	}
+	if adminFunctions[function] && function != "init" {
+		return record_admin_audit(stub, function, args)
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// record_admin_audit() - log an administrator's operation
+// ============================================================================================================================
+func record_admin_audit(stub shim.ChaincodeStubInterface, function string, args []string) error {
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return err
+	}
+	_, commonName, err := read_caller_certificate(stub)
+	if err != nil {
+		return err
+	}
+	mspId, err := cid.GetMSPID(stub)
+	if err != nil {
+		return errors.New("Could not read the caller's MSP - " + err.Error())
+	}
+
+	nanos := timestamp.Seconds*1000000000 + int64(timestamp.Nanos)
+	entry := AdminAuditEntry{
+		TxId:      stub.GetTxID(),
+		AdminId:   commonName,
+		MSPId:     mspId,
+		Function:  function,
+		Args:      args,
+		Timestamp: time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).UTC().Format(time.RFC3339Nano),
+	}
+	if entry.Args == nil {
+		entry.Args = []string{}
+	}
+	entryKey, err := stub.CreateCompositeKey(adminAuditIndex, []string{fmt.Sprintf("%020d", nanos), entry.TxId})
+	if err != nil {
+		return err
+	}
+	entryAsBytes, _ := json.Marshal(entry)
+	return stub.PutState(entryKey, entryAsBytes)
+}
+
+// ============================================================================================================================
+// Get Admin Audit - every administrator operation, oldest first
+//
+// Inputs - none
+// Returns - array of AdminAuditEntries
+// ============================================================================================================================
+func get_admin_audit(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting get_admin_audit")
+
+	if len(args) != 0 {
+		return shim.Error("Incorrect number of arguments. Expecting 0")
+	}
+
+	entries := []AdminAuditEntry{}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(adminAuditIndex, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		aKeyValue, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var entry AdminAuditEntry
+		json.Unmarshal(aKeyValue.Value, &entry)
+		entries = append(entries, entry)
+	}
+
+	entriesAsBytes, _ := json.Marshal(entries)
+	fmt.Println("- end get_admin_audit")
+	return shim.Success(entriesAsBytes)
+}
@@ -0,0 +1,224 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Get Consignment - get a consignment from ledger
+// ============================================================================================================================
+func get_consignment(stub shim.ChaincodeStubInterface, id string) (Consignment, error) {
+	var consignment Consignment
+	consignmentAsBytes, err := get_entity_state(stub, consignmentNamespace, id)
+	if err != nil {
+		return consignment, errors.New("Failed to find consignment - " + id)
+	}
+	json.Unmarshal(consignmentAsBytes, &consignment)
+
+	if consignment.Id != id {
+		return consignment, errors.New("Consignment does not exist - " + id)
+	}
+
+	return consignment, nil
+}
+
+// ============================================================================================================================
+// Init Consignment - importer groups listings awaiting their exempt check into one consignment
+//
+// The listings can then only be checked together, by passing the consignment id to check_products().
+//
+// Inputs - Array of strings
+//
+//	                                                       0
+//	                                              consignment (JSON)
+//	{"id": "consignment1", "importerId": "importer1", "listingIds": ["productlistingcontract1", "productlistingcontract2"]}
+//
+// The positional arguments are still accepted
+//
+//	       0        ,      1      ,            2            ,            3             , ...
+//	 consignment id , importer id ,        listing id       ,        listing id        , ...
+//	"consignment1"  , "importer1" , "productlistingcontract1", "productlistingcontract2"
+//
+// ============================================================================================================================
+func init_consignment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting init_consignment")
+
+	var document ConsignmentDocument
+	err = parse_document("init_consignment", args, consignment_document, &document)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var consignment Consignment
+	consignment.Id = document.Id
+	consignment.ImporterId = document.ImporterId
+	consignment.ListingIds = dedupe_strings(document.ListingIds)
+	consignment.Status = StatusExemptCheckReq
+	if len(consignment.ListingIds) < 2 {
+		return shim.Error("A consignment needs at least 2 different listings")
+	}
+	consignment.DelegatedAction, err = act_for(stub, consignment.ImporterId, "init_consignment")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	existingAsBytes, err := get_entity_state(stub, consignmentNamespace, consignment.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existingAsBytes != nil {
+		return shim.Error("This id already exists - " + consignment.Id)
+	}
+	// check_products() takes a listing or a consignment id, so they must not share one
+	_, err = get_product_listing(stub, consignment.Id)
+	if err == nil {
+		return shim.Error("This id is already used by a listing - " + consignment.Id)
+	}
+
+	var listings []ProductListingContract
+	for _, listingId := range consignment.ListingIds {
+		listing, err := get_product_listing(stub, listingId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if listing.Owner != consignment.ImporterId {
+			return shim.Error("Listing " + listing.Id + " is not held by importer " + consignment.ImporterId)
+		}
+		if len(listing.ConsignmentId) > 0 {
+			return shim.Error("Listing " + listing.Id + " is already part of consignment " + listing.ConsignmentId)
+		}
+		err = check_listing_action(listing, ActionCheckProducts, "")
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		listing.ConsignmentId = consignment.Id
+		listing.DelegatedAction = consignment.DelegatedAction
+		listings = append(listings, listing)
+	}
+
+	for _, listing := range listings {
+		err = put_product_listing(stub, listing)
+		if err != nil {
+			fmt.Println("Could not store product listing")
+			return shim.Error(err.Error())
+		}
+	}
+	err = put_consignment(stub, consignment)
+	if err != nil {
+		fmt.Println("Could not store consignment")
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end init_consignment")
+	return shim.Success(nil)
+}
+
+// consignment_document() - init_consignment's positional arguments as its document
+func consignment_document(args []string) (map[string]interface{}, error) {
+	if len(args) < 4 {
+		return nil, errors.New("Incorrect number of arguments. Expecting a consignment document, or consignment id, importer id and at least 2 listing ids")
+	}
+	var listings []interface{}
+	for _, listingId := range args[2:] {
+		listings = append(listings, listingId)
+	}
+	return map[string]interface{}{"id": args[0], "importerId": args[1], "listingIds": listings}, nil
+}
+
+// ============================================================================================================================
+// check_consignment() - combined exempt check, called from check_products()
+//
+// Every listing is evaluated against its own supplier. The consignment only clears when all of them do, otherwise
+// every listing in it goes on to hazard analysis. A cleared consignment waits for sign-off while any listing does.
+// ============================================================================================================================
+func check_consignment(stub shim.ChaincodeStubInterface, consignment Consignment, regulator Regulator) pb.Response {
+	type ConsignmentCheck struct {
+		ConsignmentId string           `json:"consignmentId"`
+		RegulatorId   string           `json:"regulatorId"`
+		Cleared       bool             `json:"cleared"`
+		Status        ListingStatus    `json:"status"`
+		Listings      []ExemptionCheck `json:"listings"`
+	}
+	fmt.Println("starting check_consignment")
+
+	if consignment.Status != StatusExemptCheckReq {
+		return shim.Error("Consignment " + consignment.Id + " has already been checked")
+	}
+
+	result := ConsignmentCheck{ConsignmentId: consignment.Id, RegulatorId: regulator.Id, Cleared: true}
+	var listings []ProductListingContract
+	for _, listingId := range consignment.ListingIds {
+		listing, err := get_product_listing(stub, listingId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		check, err := check_listing(stub, listing, regulator)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		result.Cleared = result.Cleared && check.Cleared
+		result.Listings = append(result.Listings, check)
+		listings = append(listings, listing)
+	}
+
+	for i := range listings {
+		err := apply_check(&listings[i], result.Cleared, result.Listings[i].SignOff)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		result.Listings[i].Status = listings[i].Status
+
+		err = put_product_listing(stub, listings[i])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	// the combined verdict, a consignment is only completed when none of its listings still needs sign-off
+	result.Status = StatusCheckCompleted
+	if !result.Cleared {
+		result.Status = StatusHazardAnalysisCheckReq
+	} else {
+		for _, check := range result.Listings {
+			if check.Status == StatusSignOffReq {
+				result.Status = StatusSignOffReq
+			}
+		}
+	}
+	consignment.Status = result.Status
+	consignment.CheckedBy = regulator.Id
+	consignment.Checks = result.Listings
+	err := put_consignment(stub, consignment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultAsBytes, _ := json.Marshal(result)
+	fmt.Println("- end check_consignment")
+	return shim.Success(resultAsBytes)
+}
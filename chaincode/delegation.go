@@ -0,0 +1,379 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Delegation - a licensed customs broker acting on an importer's behalf
+//
+// The importer (principal) grants a registered broker (agent) some of its operations for a validity window. While the
+// delegation holds the broker can invoke those operations in the importer's name, and every record a delegated
+// operation writes carries a DelegatedAction naming both. Each delegated action is also logged under
+// delegatedaction~principal~txid, see get_delegated_actions().
+//
+// The composite key delegation~principal~agent holds the delegation, there is at most one per pair.
+// ============================================================================================================================
+
+const (
+	delegationIndex      = "delegation"
+	delegatedActionIndex = "delegatedaction"
+)
+
+// operations an importer can delegate
+var delegableOperations = []string{
+	"transfer_product_listing", "submit_hazard_analysis", "record_disposition", "split_product_listing", "init_consignment",
+}
+
+func delegation_key(stub shim.ChaincodeStubInterface, principalId string, agentId string) (string, error) {
+	return stub.CreateCompositeKey(delegationIndex, []string{principalId, agentId})
+}
+
+// ============================================================================================================================
+// get_delegation() - delegation from principal to agent, nil if there is none
+// ============================================================================================================================
+func get_delegation(stub shim.ChaincodeStubInterface, principalId string, agentId string) (*Delegation, error) {
+	key, err := delegation_key(stub, principalId, agentId)
+	if err != nil {
+		return nil, err
+	}
+	delegationAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, errors.New("Failed to get delegation from " + principalId + " to " + agentId)
+	}
+	if delegationAsBytes == nil {
+		return nil, nil
+	}
+	var delegation Delegation
+	err = json.Unmarshal(delegationAsBytes, &delegation)
+	if err != nil {
+		return nil, err
+	}
+	return &delegation, nil
+}
+
+func put_delegation(stub shim.ChaincodeStubInterface, delegation Delegation) ([]byte, error) {
+	key, err := delegation_key(stub, delegation.PrincipalId, delegation.AgentId)
+	if err != nil {
+		return nil, err
+	}
+	delegationAsBytes, _ := json.Marshal(delegation)
+	return delegationAsBytes, stub.PutState(key, delegationAsBytes)
+}
+
+// ============================================================================================================================
+// check_delegation() - delegation letting agent invoke function for principal today, or why there is none
+// ============================================================================================================================
+func check_delegation(stub shim.ChaincodeStubInterface, principalId string, agentId string, function string) (*Delegation, error) {
+	delegation, err := get_delegation(stub, principalId, agentId)
+	if err != nil {
+		return nil, err
+	}
+	if delegation == nil {
+		return nil, errors.New(agentId + " has no delegation from " + principalId)
+	}
+	if delegation.Revoked {
+		return nil, errors.New("Delegation from " + principalId + " to " + agentId + " was revoked")
+	}
+	if !contains_string(delegation.Operations, function) {
+		return nil, errors.New("Delegation from " + principalId + " to " + agentId + " does not cover " + function)
+	}
+	today, err := tx_date(stub)
+	if err != nil {
+		return nil, err
+	}
+	validFrom, err := parse_date(delegation.ValidFrom, "Valid from")
+	if err != nil {
+		return nil, err
+	}
+	validUntil, err := parse_date(delegation.ValidUntil, "Valid until")
+	if err != nil {
+		return nil, err
+	}
+	if today.Before(validFrom) || today.After(validUntil) {
+		return nil, errors.New("Delegation from " + principalId + " to " + agentId + " is only valid from " +
+			delegation.ValidFrom + " until " + delegation.ValidUntil)
+	}
+	return delegation, nil
+}
+
+// ============================================================================================================================
+// act_for() - refuse unless the caller is principal, or an agent it delegated function to
+//
+// Returns nil when the principal acts itself. For an agent it logs the action and returns it, to be stored on the
+// records the function writes.
+// ============================================================================================================================
+func act_for(stub shim.ChaincodeStubInterface, principalId string, function string) (*DelegatedAction, error) {
+	callerErr := assert_caller(stub, principalId)
+	if callerErr == nil {
+		return nil, nil
+	}
+	agentId, err := get_caller_id(stub)
+	if err != nil {
+		return nil, err
+	}
+	if agentId == principalId {
+		return nil, callerErr
+	}
+	// the agent must be signing with its own bound certificate
+	err = assert_caller(stub, agentId)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = get_broker(stub, agentId); err != nil {
+		return nil, callerErr
+	}
+	_, err = check_delegation(stub, principalId, agentId, function)
+	if err != nil {
+		return nil, errors.New(callerErr.Error() + " - " + err.Error())
+	}
+	err = check_not_suspended(stub, agentId)
+	if err != nil {
+		return nil, err
+	}
+
+	action := DelegatedAction{
+		PrincipalId: principalId,
+		AgentId:     agentId,
+		Function:    function,
+		TxId:        stub.GetTxID(),
+	}
+	actionKey, err := stub.CreateCompositeKey(delegatedActionIndex, []string{principalId, action.TxId})
+	if err != nil {
+		return nil, err
+	}
+	actionAsBytes, _ := json.Marshal(action)
+	err = stub.PutState(actionKey, actionAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &action, nil
+}
+
+// ============================================================================================================================
+// Grant Delegation - importer lets a broker invoke some of its operations for a while
+//
+// Granting again to the same broker replaces the delegation.
+//
+// Inputs - Array of strings
+//
+//	      0     ,     1     ,      2      ,      3      ,                              4
+//	 importer id,  broker id,  valid from , valid until ,                  operations (JSON)
+//	"importer1" ,  "broker1", "2018-06-01", "2018-12-31", ["transfer_product_listing", "submit_hazard_analysis"]
+//
+// The window is inclusive, dates are YYYY-MM-DD. Operations are any of transfer_product_listing,
+// submit_hazard_analysis, record_disposition, split_product_listing and init_consignment.
+//
+// Returns - the Delegation
+// ============================================================================================================================
+func grant_delegation(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting grant_delegation")
+
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 5. importer id, broker id, valid from, valid until and operations")
+	}
+
+	var delegation Delegation
+	delegation.PrincipalId = args[0]
+	delegation.AgentId = args[1]
+	delegation.ValidFrom = args[2]
+	delegation.ValidUntil = args[3]
+	delegation.GrantedTxId = stub.GetTxID()
+	delegation.Operations, err = parse_string_list(args[4], "Operations")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(delegation.Operations) == 0 {
+		return shim.Error("Expecting at least one operation to delegate")
+	}
+	for _, operation := range delegation.Operations {
+		if !contains_string(delegableOperations, operation) {
+			return shim.Error("Operation " + operation + " cannot be delegated")
+		}
+	}
+
+	validFrom, err := parse_date(delegation.ValidFrom, "Valid from")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	validUntil, err := parse_date(delegation.ValidUntil, "Valid until")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if validUntil.Before(validFrom) {
+		return shim.Error("Valid until " + delegation.ValidUntil + " is before valid from " + delegation.ValidFrom)
+	}
+
+	_, err = get_importer(stub, delegation.PrincipalId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = assert_caller(stub, delegation.PrincipalId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	_, err = get_broker(stub, delegation.AgentId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	delegationAsBytes, err := put_delegation(stub, delegation)
+	if err != nil {
+		fmt.Println("Could not store delegation")
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end grant_delegation")
+	return shim.Success(delegationAsBytes)
+}
+
+// ============================================================================================================================
+// Revoke Delegation - importer withdraws a broker's delegation before it runs out
+//
+// Inputs - Array of strings
+//
+//	      0     ,     1
+//	 importer id,  broker id
+//	"importer1" ,  "broker1"
+//
+// Returns - the revoked Delegation
+// ============================================================================================================================
+func revoke_delegation(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting revoke_delegation")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2. importer id and broker id")
+	}
+
+	err = assert_caller(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	delegation, err := get_delegation(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if delegation == nil {
+		return shim.Error(args[1] + " has no delegation from " + args[0])
+	}
+	if delegation.Revoked {
+		return shim.Error("Delegation from " + args[0] + " to " + args[1] + " is already revoked")
+	}
+	delegation.Revoked = true
+	delegation.RevokedTxId = stub.GetTxID()
+
+	delegationAsBytes, err := put_delegation(stub, *delegation)
+	if err != nil {
+		fmt.Println("Could not store delegation")
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end revoke_delegation")
+	return shim.Success(delegationAsBytes)
+}
+
+// ============================================================================================================================
+// Get Delegations - every delegation an importer has granted, including revoked and expired ones
+//
+// Inputs - Array of strings
+//
+//	      0
+//	 importer id
+//	"importer1"
+//
+// Returns - array of Delegations
+// ============================================================================================================================
+func get_delegations(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting get_delegations")
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting importer id")
+	}
+
+	delegations := []Delegation{}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(delegationIndex, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		aKeyValue, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var delegation Delegation
+		json.Unmarshal(aKeyValue.Value, &delegation)
+		delegations = append(delegations, delegation)
+	}
+
+	delegationsAsBytes, _ := json.Marshal(delegations)
+	fmt.Println("- end get_delegations")
+	return shim.Success(delegationsAsBytes)
+}
+
+// ============================================================================================================================
+// Get Delegated Actions - everything brokers have done in an importer's name
+//
+// Inputs - Array of strings
+//
+//	      0
+//	 importer id
+//	"importer1"
+//
+// Returns - array of DelegatedActions
+// ============================================================================================================================
+func get_delegated_actions(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting get_delegated_actions")
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting importer id")
+	}
+
+	actions := []DelegatedAction{}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(delegatedActionIndex, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		aKeyValue, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var action DelegatedAction
+		json.Unmarshal(aKeyValue.Value, &action)
+		actions = append(actions, action)
+	}
+
+	actionsAsBytes, _ := json.Marshal(actions)
+	fmt.Println("- end get_delegated_actions")
+	return shim.Success(actionsAsBytes)
+}
@@ -0,0 +1,179 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Reject Listing - regulator refuses entry to a listing that is being checked
+//
+// Any hazard analysis report still under review is rejected along with the listing.
+//
+// Inputs - Array of strings
+//
+//	     0            ,      1      ,          2          ,          3
+//	listing id        , regulator id,        reason       , correction allowed
+//
+// "productlistingcontract1", "regulator1", "Listeria detected" ,       "false"
+// ============================================================================================================================
+func reject_listing(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting reject_listing")
+
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4. listing id, regulator id, reason and correction allowed")
+	}
+
+	reason := strings.TrimSpace(args[2])
+	if len(reason) == 0 {
+		return shim.Error("A reason is required to reject a listing")
+	}
+	correctionAllowed, err := strconv.ParseBool(args[3])
+	if err != nil {
+		return shim.Error("Correction allowed must be \"true\" or \"false\"")
+	}
+
+	productListing, err := get_product_listing(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	regulator, err := get_regulator(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = assert_caller(stub, regulator.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = check_jurisdiction(regulator, productListing)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	underReview := productListing.Status == StatusHazardAnalysisReview
+	err = transition_listing(&productListing, ActionRejectListing, StatusRejected)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	productListing.Rejection = &ListingRejection{
+		RegulatorId:       regulator.Id,
+		Reason:            reason,
+		CorrectionAllowed: correctionAllowed,
+		TxId:              stub.GetTxID(),
+	}
+
+	if underReview {
+		report, err := get_hazard_report(stub, productListing.HazardReportId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		report.Status = ReportRejected
+		report.ReviewedBy = regulator.Id
+		report.ReviewComment = reason
+		err = put_hazard_report(stub, report)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	err = put_product_listing(stub, productListing)
+	if err != nil {
+		fmt.Println("Could not store product listing")
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end reject_listing")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Record Disposition - importer records what happened to a rejected listing, closing it out
+//
+// RELEASED_AFTER_CORRECTION is only possible when the regulator allowed correction, and lets the importer
+// transfer the listing to a retailer.
+//
+// Inputs - Array of strings
+//
+//	     0            ,      1      ,                     2                        ,      3
+//	listing id        , importer id ,                disposition                   ,  reference
+//
+// "productlistingcontract1", "importer1" , RE_EXPORTED/DESTROYED/RELEASED_AFTER_CORRECTION,  "EXD-2018-114"
+// ============================================================================================================================
+func record_disposition(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting record_disposition")
+
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4. listing id, importer id, disposition and reference")
+	}
+
+	// the document the disposal, re-export or correction is recorded against, checked as text by check_arguments()
+	reference := strings.TrimSpace(args[3])
+	if len(reference) == 0 {
+		return shim.Error("A reference document is required to record a disposition")
+	}
+	outcome := ListingStatus(args[2])
+	if outcome != StatusReExported && outcome != StatusDestroyed && outcome != StatusReleasedAfterCorrection {
+		return shim.Error("Invalid disposition " + args[2] + ". Expecting RE_EXPORTED, DESTROYED or RELEASED_AFTER_CORRECTION")
+	}
+
+	productListing, err := get_product_listing(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if productListing.Owner != args[1] {
+		return shim.Error("Only the importer holding listing " + productListing.Id + " can record its disposition")
+	}
+	delegatedAction, err := act_for(stub, args[1], "record_disposition")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if outcome == StatusReleasedAfterCorrection && (productListing.Rejection == nil || !productListing.Rejection.CorrectionAllowed) {
+		return shim.Error("Regulator did not allow listing " + productListing.Id + " to be released after correction")
+	}
+
+	err = transition_listing(&productListing, ActionRecordDisposition, outcome)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	productListing.Disposition = &ListingDisposition{
+		ImporterId: args[1],
+		Outcome:    outcome,
+		Reference:  reference,
+		TxId:       stub.GetTxID(),
+	}
+	productListing.DelegatedAction = delegatedAction
+
+	err = put_product_listing(stub, productListing)
+	if err != nil {
+		fmt.Println("Could not store product listing")
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end record_disposition")
+	return shim.Success(nil)
+}
@@ -0,0 +1,116 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// ============================================================================================================================
+// Exemption Check - the verdict of a regulator's exempt check on a listing, returned by check_products()
+// ============================================================================================================================
+type ExemptionCheck struct {
+	ListingId         string        `json:"listingId"`
+	RegulatorId       string        `json:"regulatorId"`
+	CountryId         string        `json:"countryId"` // jurisdiction whose exemptions applied
+	SupplierId        string        `json:"supplierId"`
+	OrgId             string        `json:"orgId"`
+	OrgExempt         bool          `json:"orgExempt"`
+	ExemptProducts    []string      `json:"exemptProducts"`
+	NonExemptProducts []string      `json:"nonExemptProducts"`
+	Cleared           bool          `json:"cleared"`
+	SignOff           *SignOff      `json:"signOff,omitempty"` // high risk, see sign_off.go
+	Status            ListingStatus `json:"status"`
+}
+
+// ============================================================================================================================
+// evaluate_exemptions() - same rules as checkProducts in lib/foodSupply.js
+//
+// A listing is cleared when the supplier's org is exempted, or failing that, when every product in it is exempted.
+// Otherwise it needs a hazard analysis. Only the exemptions of the regulator's jurisdiction count.
+// ============================================================================================================================
+func evaluate_exemptions(listing ProductListingContract, supplier Supplier, regulator Regulator, jurisdiction Jurisdiction) ExemptionCheck {
+	check := ExemptionCheck{
+		ListingId:         listing.Id,
+		RegulatorId:       regulator.Id,
+		CountryId:         jurisdiction.CountryId,
+		SupplierId:        listing.Supplier,
+		OrgId:             supplier.OrgId,
+		ExemptProducts:    []string{},
+		NonExemptProducts: []string{},
+	}
+
+	check.OrgExempt = len(supplier.OrgId) > 0 && contains_string(jurisdiction.ExemptedOrgIds, supplier.OrgId)
+	for _, productId := range listing.Products {
+		if contains_string(jurisdiction.ExemptedProductIds, productId) {
+			check.ExemptProducts = append(check.ExemptProducts, productId)
+		} else {
+			check.NonExemptProducts = append(check.NonExemptProducts, productId)
+		}
+	}
+
+	check.Cleared = check.OrgExempt || len(check.NonExemptProducts) == 0
+	return check
+}
+
+// ============================================================================================================================
+// check_listing() - run the exempt check on a listing, nothing is written
+// ============================================================================================================================
+func check_listing(stub shim.ChaincodeStubInterface, listing ProductListingContract, regulator Regulator) (ExemptionCheck, error) {
+	err := check_listing_action(listing, ActionCheckProducts, "")
+	if err != nil {
+		return ExemptionCheck{}, err
+	}
+	err = check_jurisdiction(regulator, listing)
+	if err != nil {
+		return ExemptionCheck{}, err
+	}
+	err = check_not_suspended(stub, listing.Owner, listing.Supplier)
+	if err != nil {
+		return ExemptionCheck{}, err
+	}
+	supplier, err := get_supplier(stub, listing.Supplier)
+	if err != nil {
+		return ExemptionCheck{}, err
+	}
+	jurisdiction, err := get_jurisdiction(stub, regulator.CountryId)
+	if err != nil {
+		return ExemptionCheck{}, err
+	}
+	check := evaluate_exemptions(listing, supplier, regulator, jurisdiction)
+	check.SignOff, err = assess_risk(stub, listing, jurisdiction)
+	if err != nil {
+		return ExemptionCheck{}, err
+	}
+	return check, nil
+}
+
+// ============================================================================================================================
+// apply_check() - move a checked listing on to CHECKCOMPLETED, SIGNOFFREQ or HAZARDANALYSISCHECKREQ
+//
+// A high risk listing keeps its sign off requirement through hazard analysis.
+// ============================================================================================================================
+func apply_check(listing *ProductListingContract, cleared bool, signOff *SignOff) error {
+	listing.SignOff = signOff
+	if cleared {
+		return transition_listing(listing, ActionCheckProducts, cleared_status(*listing))
+	}
+	return transition_listing(listing, ActionCheckProducts, StatusHazardAnalysisCheckReq)
+}
@@ -0,0 +1,206 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Expiry - dates are calendar days (YYYY-MM-DD) in UTC, compared against the transaction's timestamp so every peer
+// reaches the same answer
+// ============================================================================================================================
+
+const dateLayout = "2006-01-02"
+
+func parse_date(value string, name string) (time.Time, error) {
+	date, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return date, errors.New(name + " must be a date formatted YYYY-MM-DD, got " + value)
+	}
+	return date, nil
+}
+
+// day the transaction was proposed on
+func tx_date(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	txTime := time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).UTC()
+	return time.Date(txTime.Year(), txTime.Month(), txTime.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+// ============================================================================================================================
+// validate_product_dates() - lot number and dates given to init_product, every problem by field
+// ============================================================================================================================
+func validate_product_dates(stub shim.ChaincodeStubInterface, product Product) ([]string, error) {
+	var problems []string
+	if len(strings.TrimSpace(product.LotNumber)) == 0 {
+		problems = append(problems, "lotNumber: must be a non-empty string")
+	}
+	produced, err := parse_date(product.ProductionDate, "Production date")
+	if err != nil {
+		problems = append(problems, "productionDate: "+err.Error())
+	}
+	bestBefore, err := parse_date(product.BestBefore, "Best before")
+	if err != nil {
+		problems = append(problems, "bestBefore: "+err.Error())
+	}
+	if len(problems) > 0 {
+		return problems, nil
+	}
+	today, err := tx_date(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	if produced.After(today) {
+		problems = append(problems, "productionDate: Production date "+product.ProductionDate+" is in the future")
+	}
+	if bestBefore.Before(produced) {
+		problems = append(problems, "bestBefore: Best before "+product.BestBefore+" is before production date "+product.ProductionDate)
+	}
+	return problems, nil
+}
+
+// ============================================================================================================================
+// check_not_expired() - refuse if any of the products is past its best before date
+//
+// Products without a best before date never expire.
+// ============================================================================================================================
+func check_not_expired(stub shim.ChaincodeStubInterface, productIds []string) error {
+	today, err := tx_date(stub)
+	if err != nil {
+		return err
+	}
+
+	var expired []string
+	for _, productId := range productIds {
+		product, err := get_product(stub, productId)
+		if err != nil {
+			return err
+		}
+		if len(product.BestBefore) == 0 {
+			continue
+		}
+		bestBefore, err := parse_date(product.BestBefore, "Best before")
+		if err != nil {
+			return errors.New("Product " + product.Id + " - " + err.Error())
+		}
+		if bestBefore.Before(today) {
+			expired = append(expired, product.Id+" (best before "+product.BestBefore+")")
+		}
+	}
+
+	if len(expired) > 0 {
+		return errors.New("Expired products cannot be listed or transferred - " + strings.Join(expired, ", "))
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Get Expiring Products - products a retailer holds that reach their best before date within some days
+//
+// Expired products are included with a negative daysRemaining.
+//
+// Inputs - Array of strings
+//
+//	     0      ,   1
+//	retailer id , days
+//	"retailer1" , "7"
+//
+// Returns:
+//
+//	[{
+//		"id": "product1",
+//		"lotNumber": "L2018-114",
+//		"bestBefore": "2018-09-01",
+//		"daysRemaining": 3,
+//		"expired": false
+//	}]
+//
+// ============================================================================================================================
+func get_expiring_products(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	type ExpiringProduct struct {
+		Id            string `json:"id"`
+		LotNumber     string `json:"lotNumber"`
+		BestBefore    string `json:"bestBefore"`
+		DaysRemaining int    `json:"daysRemaining"`
+		Expired       bool   `json:"expired"`
+	}
+	fmt.Println("starting get_expiring_products")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2. retailer id and days")
+	}
+	days, err := strconv.Atoi(args[1])
+	if err != nil || days < 0 {
+		return shim.Error("Days must be a whole number of days, 0 or more")
+	}
+
+	retailer, err := get_retailer(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	today, err := tx_date(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	expiring := []ExpiringProduct{}
+	for _, productId := range dedupe_strings(retailer.Products) {
+		product, err := get_product(stub, productId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if len(product.BestBefore) == 0 {
+			continue
+		}
+		bestBefore, err := parse_date(product.BestBefore, "Best before")
+		if err != nil {
+			return shim.Error("Product " + product.Id + " - " + err.Error())
+		}
+		remaining := int(bestBefore.Sub(today).Hours() / 24)
+		if remaining <= days {
+			expiring = append(expiring, ExpiringProduct{product.Id, product.LotNumber, product.BestBefore, remaining, remaining < 0})
+		}
+	}
+	sort.Slice(expiring, func(i, j int) bool {
+		if expiring[i].BestBefore != expiring[j].BestBefore {
+			return expiring[i].BestBefore < expiring[j].BestBefore
+		}
+		return expiring[i].Id < expiring[j].Id
+	})
+
+	expiringAsBytes, _ := json.Marshal(expiring)
+	fmt.Println("- end get_expiring_products")
+	return shim.Success(expiringAsBytes)
+}
@@ -0,0 +1,271 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ============================================================================================================================
+// Fields - what each kind of value a function takes must look like
+//
+// Every kind of field has one validator, named by a format: ids, ISO 3166 country codes, GTINs, dates, quantities,
+// day counts, sha256 digests and free text. The arguments of every function are declared once in functionArguments
+// and checked by check_arguments() before the function runs, and the init_* documents use the same formats through
+// their schemas, see schema.go. Arguments holding JSON or a choice the function checks itself have no format.
+// ============================================================================================================================
+
+const (
+	maxIdLength   = 64
+	maxTextLength = 512
+	maxDays       = 3650
+)
+
+// validators by format, each returns what is wrong with a value, "" if nothing
+var fieldFormats = map[string]func(string) string{
+	"id":       valid_id,
+	"country":  valid_country_code,
+	"gtin":     valid_gtin,
+	"date":     valid_date,
+	"quantity": valid_quantity,
+	"days":     valid_days,
+	"sha256":   valid_sha256,
+	"text":     valid_text,
+}
+
+type ArgumentField struct {
+	Name   string // as reported, eg "listingId"
+	Format string // see fieldFormats, "" if the function checks the argument itself
+	Repeat bool   // the last field, taken by every remaining argument
+}
+
+// the positional arguments of every function, in order. The init_* functions are checked against their schemas instead,
+// query and get_schema check their own arguments.
+var functionArguments = map[string][]ArgumentField{
+	"read":                     {{Name: "type"}, {Name: "id", Format: "id"}}, // or a plain key, see read()
+	"write":                    {{Name: "key", Format: "id"}, {Name: "value", Format: "text"}},
+	"rotate_identity":          {{Name: "participantId", Format: "id"}, {Name: "fingerprint", Format: "sha256"}},
+	"confirm_identity":         {{Name: "participantId", Format: "id"}, {Name: "fingerprint", Format: "sha256"}},
+	"update_user":              {{Name: "participantId", Format: "id"}, {Name: "profile"}},
+	"transfer_product_listing": {{Name: "listingId", Format: "id"}, {Name: "newOwnerId", Format: "id"}},
+	"check_products":           {{Name: "listingId", Format: "id"}, {Name: "regulatorId", Format: "id"}},
+	"update_exempted_list":     {{Name: "regulatorId", Format: "id"}, {Name: "exemptedType"}, {Name: "mode"}, {Name: "ids", Format: "id", Repeat: true}},
+	"submit_hazard_analysis": {{Name: "reportId", Format: "id"}, {Name: "listingId", Format: "id"}, {Name: "importerId", Format: "id"},
+		{Name: "documentHash", Format: "sha256"}, {Name: "hazards"}, {Name: "preventiveControls"}, {Name: "labReferences"}},
+	"approve_hazard_analysis": {{Name: "reportId", Format: "id"}, {Name: "regulatorId", Format: "id"}, {Name: "comment", Format: "text"}},
+	"reject_hazard_analysis":  {{Name: "reportId", Format: "id"}, {Name: "regulatorId", Format: "id"}, {Name: "reason", Format: "text"}},
+	"set_risk_policy":         {{Name: "regulatorId", Format: "id"}, {Name: "categories"}, {Name: "origins"}, {Name: "panel"}, {Name: "quorum"}},
+	"sign_off_listing":        {{Name: "listingId", Format: "id"}, {Name: "regulatorId", Format: "id"}, {Name: "decision"}, {Name: "reason", Format: "text"}},
+	"reject_listing":          {{Name: "listingId", Format: "id"}, {Name: "regulatorId", Format: "id"}, {Name: "reason", Format: "text"}, {Name: "correctionAllowed"}},
+	"record_disposition":      {{Name: "listingId", Format: "id"}, {Name: "importerId", Format: "id"}, {Name: "disposition"}, {Name: "reference", Format: "text"}},
+	"split_product_listing":   {{Name: "listingId", Format: "id"}, {Name: "importerId", Format: "id"}, {Name: "children"}},
+	"sell_product":            {{Name: "retailerId", Format: "id"}, {Name: "productId", Format: "id"}, {Name: "quantity", Format: "quantity"}, {Name: "reference", Format: "text"}},
+	"dispose_product":         {{Name: "retailerId", Format: "id"}, {Name: "productId", Format: "id"}, {Name: "quantity", Format: "quantity"}, {Name: "reason", Format: "text"}},
+	"write_off_product":       {{Name: "retailerId", Format: "id"}, {Name: "productId", Format: "id"}, {Name: "quantity", Format: "quantity"}, {Name: "reason", Format: "text"}},
+	"grant_delegation": {{Name: "importerId", Format: "id"}, {Name: "brokerId", Format: "id"}, {Name: "validFrom", Format: "date"},
+		{Name: "validUntil", Format: "date"}, {Name: "operations"}},
+	"revoke_delegation":       {{Name: "importerId", Format: "id"}, {Name: "brokerId", Format: "id"}},
+	"suspend_participant":     {{Name: "participantId", Format: "id"}, {Name: "regulatorId", Format: "id"}, {Name: "reason", Format: "text"}, {Name: "effectiveDate", Format: "date"}},
+	"reinstate_participant":   {{Name: "participantId", Format: "id"}, {Name: "regulatorId", Format: "id"}, {Name: "reason", Format: "text"}},
+	"get_listing_totals":      {{Name: "listingId", Format: "id"}, {Name: "unit"}},
+	"get_retailer_totals":     {{Name: "retailerId", Format: "id"}, {Name: "unit"}},
+	"get_listing_lineage":     {{Name: "listingId", Format: "id"}},
+	"get_expiring_products":   {{Name: "retailerId", Format: "id"}, {Name: "days", Format: "days"}},
+	"get_stock_ledger":        {{Name: "retailerId", Format: "id"}, {Name: "productId", Format: "id"}},
+	"getHistory":              {{Name: "productId", Format: "id"}},
+	"get_listing_transitions": {{Name: "listingId", Format: "id"}},
+	"get_user":                {{Name: "participantId", Format: "id"}},
+	"get_delegations":         {{Name: "importerId", Format: "id"}},
+	"get_delegated_actions":   {{Name: "importerId", Format: "id"}},
+	"get_suspension_history":  {{Name: "participantId", Format: "id"}},
+	"get_exemptions":          {{Name: "countryId", Format: "country"}},
+}
+
+// ============================================================================================================================
+// check_arguments() - check a function's arguments against their formats, reporting every problem
+//
+// Missing or extra arguments are left to the function, which knows the forms it accepts.
+// ============================================================================================================================
+func check_arguments(function string, args []string) error {
+	fields, ok := functionArguments[function]
+	if !ok {
+		return nil
+	}
+	if function == "read" && len(args) == 1 {
+		return nil // a plain key
+	}
+	var problems []string
+	for i, arg := range args {
+		if len(fields) == 0 {
+			break
+		}
+		field := fields[len(fields)-1]
+		if i < len(fields) {
+			field = fields[i]
+		} else if !field.Repeat {
+			break
+		}
+		if len(field.Format) == 0 {
+			continue
+		}
+		name := field.Name
+		if field.Repeat {
+			name = fmt.Sprintf("%s[%d]", field.Name, i-len(fields)+1)
+		}
+		if problem := fieldFormats[field.Format](arg); len(problem) > 0 {
+			problems = append(problems, name+": "+problem)
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New("Invalid arguments to " + function + " - " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// check_field() - check one value against a format, for values that arrive inside JSON
+func check_field(name string, format string, value string) error {
+	if problem := fieldFormats[format](value); len(problem) > 0 {
+		return errors.New(name + ": " + problem)
+	}
+	return nil
+}
+
+// ========================================================
+// Field validators - return what is wrong with a value, "" if nothing
+//
+// valid_country_code and the profile validators are in profile.go, valid_quantity in quantity.go
+// ========================================================
+
+// letters, digits and - _ . : @ ( ), so certificate common names and GS1 element strings such as
+// (01)09506000134352(10)L2018-114 can be used as ids
+func valid_id(value string) string {
+	if len(value) == 0 {
+		return "must be a non-empty string"
+	}
+	if utf8.RuneCountInString(value) > maxIdLength {
+		return fmt.Sprintf("must be <= %d characters", maxIdLength)
+	}
+	for _, r := range value {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-_.:@()", r) {
+			return "must contain only letters, digits and - _ . : @ ( )"
+		}
+	}
+	return ""
+}
+
+// reasons, references and comments, which functions that need one check for themselves
+func valid_text(value string) string {
+	if utf8.RuneCountInString(value) > maxTextLength {
+		return fmt.Sprintf("must be <= %d characters", maxTextLength)
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) {
+			return "must not contain control characters"
+		}
+	}
+	return ""
+}
+
+func valid_date(value string) string {
+	_, err := parse_date(value, "")
+	if err != nil {
+		return "must be a date formatted YYYY-MM-DD"
+	}
+	return ""
+}
+
+func valid_days(value string) string {
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 || days > maxDays {
+		return fmt.Sprintf("must be a whole number of days from 0 to %d", maxDays)
+	}
+	return ""
+}
+
+func valid_sha256(value string) string {
+	if len(value) != 64 {
+		return "must be a hex encoded sha256 digest"
+	}
+	for _, r := range strings.ToLower(value) {
+		if !(r >= '0' && r <= '9') && !(r >= 'a' && r <= 'f') {
+			return "must be a hex encoded sha256 digest"
+		}
+	}
+	return ""
+}
+
+// ============================================================================================================================
+// GTINs - GS1 trade item numbers
+//
+// GTIN-8, 12, 13 and 14 are accepted, bare or with the (01) application identifier, and stored as GTIN-14, padded with
+// leading zeros.
+// ============================================================================================================================
+func valid_gtin(value string) string {
+	_, problem := normalize_gtin(value)
+	return problem
+}
+
+// normalize_gtin() - the GTIN-14 of a GTIN, and what is wrong with it if anything
+func normalize_gtin(value string) (string, string) {
+	digits := strings.TrimPrefix(value, "(01)")
+	if len(digits) != 8 && len(digits) != 12 && len(digits) != 13 && len(digits) != 14 {
+		return "", "must be a GTIN-8, 12, 13 or 14"
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return "", "must contain only digits after the (01) prefix"
+		}
+	}
+	gtin := strings.Repeat("0", 14-len(digits)) + digits
+	if gtin_check_digit(gtin[:13]) != gtin[13] {
+		return "", "check digit does not match, expecting " + string(gtin_check_digit(gtin[:13]))
+	}
+	return gtin, ""
+}
+
+// GS1 mod 10: digits weighted 3 and 1 alternately from the right
+func gtin_check_digit(digits string) byte {
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		digit := int(digits[i] - '0')
+		if (len(digits)-1-i)%2 == 0 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// ============================================================================================================================
+// Countries - ISO 3166-1 alpha-2 codes officially assigned
+// ============================================================================================================================
+var countryCodes = strings.Fields(`
+	AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ BA BB BD BE BF BG BH BI BJ BL BM BN BO BQ BR BS BT BV BW BY BZ
+	CA CC CD CF CG CH CI CK CL CM CN CO CR CU CV CW CX CY CZ DE DJ DK DM DO DZ EC EE EG EH ER ES ET FI FJ FK FM FO FR
+	GA GB GD GE GF GG GH GI GL GM GN GP GQ GR GS GT GU GW GY HK HM HN HR HT HU ID IE IL IM IN IO IQ IR IS IT JE JM JO
+	JP KE KG KH KI KM KN KP KR KW KY KZ LA LB LC LI LK LR LS LT LU LV LY MA MC MD ME MF MG MH MK ML MM MN MO MP MQ MR
+	MS MT MU MV MW MX MY MZ NA NC NE NF NG NI NL NO NP NR NU NZ OM PA PE PF PG PH PK PL PM PN PR PS PT PW PY QA RE RO
+	RS RU RW SA SB SC SD SE SG SH SI SJ SK SL SM SN SO SR SS ST SV SX SY SZ TC TD TF TG TH TJ TK TL TM TN TO TR TT TV
+	TW TZ UA UG UM US UY UZ VA VC VE VG VI VN VU WF WS YE YT ZA ZM ZW`)
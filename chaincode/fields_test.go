@@ -0,0 +1,200 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGtinCheckDigit(t *testing.T) {
+	cases := []struct {
+		digits string // a GTIN without its check digit
+		want   byte
+	}{
+		{"0950600013435", '2'}, // GS1's example GTIN-14, 09506000134352
+		{"400638133393", '1'},  // EAN-13 4006381333931
+		{"03600029145", '2'},   // UPC-A 036000291452
+		{"9638507", '4'},       // EAN-8 96385074
+		{"0000000000000", '0'},
+		{"0000000000001", '7'},
+		{"0000000000010", '9'},
+	}
+	for _, c := range cases {
+		if got := gtin_check_digit(c.digits); got != c.want {
+			t.Errorf("gtin_check_digit(%s) = %c, want %c", c.digits, got, c.want)
+		}
+	}
+}
+
+func TestNormalizeGtin(t *testing.T) {
+	cases := []struct {
+		value   string
+		want    string
+		problem string // start of the problem reported, empty when the GTIN is valid
+	}{
+		{"09506000134352", "09506000134352", ""},
+		{"(01)09506000134352", "09506000134352", ""},
+		{"4006381333931", "04006381333931", ""},
+		{"036000291452", "00036000291452", ""},
+		{"96385074", "00000096385074", ""},
+		{"(01)96385074", "00000096385074", ""},
+		{"09506000134353", "", "check digit does not match, expecting 2"},
+		{"4006381333932", "", "check digit does not match, expecting 1"},
+		{"0950600013435", "", "check digit does not match"},
+		{"9506000134352", "09506000134352", ""}, // a GTIN-13, the same trade item padded
+		{"", "", "must be a GTIN-8, 12, 13 or 14"},
+		{"1234567", "", "must be a GTIN-8, 12, 13 or 14"},
+		{"123456789", "", "must be a GTIN-8, 12, 13 or 14"},
+		{"095060001343520", "", "must be a GTIN-8, 12, 13 or 14"},
+		{"(01)", "", "must be a GTIN-8, 12, 13 or 14"},
+		{"(02)09506000134352", "", "must be a GTIN-8, 12, 13 or 14"},
+		{"0950600013435A", "", "must contain only digits"},
+		{"0950 000134352", "", "must contain only digits"},
+		{"-9506000134352", "", "must contain only digits"},
+	}
+	for _, c := range cases {
+		gtin, problem := normalize_gtin(c.value)
+		if len(c.problem) == 0 {
+			if len(problem) > 0 || gtin != c.want {
+				t.Errorf("normalize_gtin(%q) = %q, %q, want %q", c.value, gtin, problem, c.want)
+			}
+			if valid_gtin(c.value) != "" {
+				t.Errorf("valid_gtin(%q) should report no problem", c.value)
+			}
+			continue
+		}
+		if !strings.HasPrefix(problem, c.problem) || len(gtin) > 0 {
+			t.Errorf("normalize_gtin(%q) = %q, %q, want problem %q", c.value, gtin, problem, c.problem)
+		}
+		if valid_gtin(c.value) != problem {
+			t.Errorf("valid_gtin(%q) should report %q", c.value, problem)
+		}
+	}
+}
+
+func TestValidCountryCode(t *testing.T) {
+	for _, code := range []string{"US", "GB", "DE", "NZ", "AX", "SS", "ZW", "AD"} {
+		if problem := valid_country_code(code); len(problem) > 0 {
+			t.Errorf("valid_country_code(%q) = %q, want no problem", code, problem)
+		}
+	}
+	// lower case, alpha-3, numeric, reserved and user-assigned codes are refused
+	for _, code := range []string{"", "us", "Us", "USA", "840", "U", "UK", "EU", "XK", "ZZ", "AA", " US", "US "} {
+		if problem := valid_country_code(code); len(problem) == 0 {
+			t.Errorf("valid_country_code(%q) should report a problem", code)
+		}
+	}
+	seen := map[string]bool{}
+	for _, code := range countryCodes {
+		if len(code) != 2 || strings.ToUpper(code) != code {
+			t.Errorf("country code %q is not two upper case letters", code)
+		}
+		if seen[code] {
+			t.Errorf("country code %q is listed twice", code)
+		}
+		seen[code] = true
+	}
+	if len(countryCodes) != 249 {
+		t.Errorf("%d country codes, ISO 3166-1 assigns 249", len(countryCodes))
+	}
+}
+
+func TestValidId(t *testing.T) {
+	valid := []string{
+		"supplier1", "productlistingcontract1", "a", "Lot-2018_114", "user@example.com", "urn:lot:1",
+		"(01)09506000134352(10)L2018-114", "fournisseur-é", "供应商1", strings.Repeat("a", maxIdLength),
+		strings.Repeat("é", maxIdLength),
+	}
+	for _, value := range valid {
+		if problem := valid_id(value); len(problem) > 0 {
+			t.Errorf("valid_id(%q) = %q, want no problem", value, problem)
+		}
+	}
+	cases := []struct {
+		value   string
+		problem string
+	}{
+		{"", "must be a non-empty string"},
+		{strings.Repeat("a", maxIdLength+1), "must be <= 64 characters"},
+		{strings.Repeat("é", maxIdLength+1), "must be <= 64 characters"},
+		{"supplier 1", "must contain only letters, digits and - _ . : @ ( )"},
+		{"supplier/1", "must contain only letters, digits and - _ . : @ ( )"},
+		{"supplier\x001", "must contain only letters, digits and - _ . : @ ( )"},
+		{"supplier\n", "must contain only letters, digits and - _ . : @ ( )"},
+		{"{\"id\":1}", "must contain only letters, digits and - _ . : @ ( )"},
+		{"~key", "must contain only letters, digits and - _ . : @ ( )"},
+	}
+	for _, c := range cases {
+		if problem := valid_id(c.value); problem != c.problem {
+			t.Errorf("valid_id(%q) = %q, want %q", c.value, problem, c.problem)
+		}
+	}
+}
+
+func TestCheckArguments(t *testing.T) {
+	cases := []struct {
+		function string
+		args     []string
+		problems []string // expected in the error, nil when the arguments pass
+	}{
+		{"transfer_product_listing", []string{"l1", "importer1"}, nil},
+		{"transfer_product_listing", []string{"l 1", "importer/1"}, []string{"listingId: must contain only", "newOwnerId: must contain only"}},
+		{"transfer_product_listing", []string{"l1"}, nil}, // the function counts its own arguments
+		{"get_exemptions", []string{"us"}, []string{"countryId: must be an ISO 3166 country code"}},
+		{"update_exempted_list", []string{"regulator1", "org", "add", "org1", "org 2", "org3", ""},
+			[]string{"ids[1]: must contain only", "ids[3]: must be a non-empty string"}},
+		{"update_user", []string{"supplier1", "{\"legalName\": \"Acme\"}"}, nil},
+		{"record_disposition", []string{"l1", "importer1", "DESTROYED", "certificate\x07"}, []string{"reference: must not contain control characters"}},
+		{"read", []string{"selftest key"}, nil}, // a plain key
+		{"read", []string{"product", "p 1"}, []string{"id: must contain only"}},
+		{"not_a_function", []string{"anything goes"}, nil},
+	}
+	for _, c := range cases {
+		err := check_arguments(c.function, c.args)
+		if c.problems == nil {
+			if err != nil {
+				t.Errorf("%s%q: %s", c.function, c.args, err.Error())
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s%q should fail", c.function, c.args)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), "Invalid arguments to "+c.function+" - ") {
+			t.Errorf("%s%q: unexpected error %q", c.function, c.args, err.Error())
+		}
+		for _, problem := range c.problems {
+			if !strings.Contains(err.Error(), problem) {
+				t.Errorf("%s%q: %q should report %q", c.function, c.args, err.Error(), problem)
+			}
+		}
+	}
+
+	// every format named in functionArguments has a validator
+	for function, fields := range functionArguments {
+		for _, field := range fields {
+			if _, ok := fieldFormats[field.Format]; len(field.Format) > 0 && !ok {
+				t.Errorf("%s.%s has unknown format %q", function, field.Name, field.Format)
+			}
+		}
+	}
+}
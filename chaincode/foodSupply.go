@@ -35,22 +35,24 @@ type SimpleChaincode struct {
 // Product Definitions - The ledger will store marbles and owners
 // ============================================================================================================================
 
-// TODO, add
-// type Status struct{
-//   o INITIALREQUEST
-//   o EXEMPTCHECKREQ
-//   o HAZARDANALYSISCHECKREQ
-//   o CHECKCOMPLETED
-// }
-
+// Listing statuses and the transitions between them live in listing_status.go
 
 // Concept
 type Product struct {
-	// ObjectType string        `json:"docType"` //field for couchdb
+	ObjectType string `json:"docType"` //field for couchdb
 	// productId       string          `json:"productId"`      //the fieldtags are needed to keep case from bouncing around
-  Id       string          `json:"id"`
-	Quantity      string        `json:"quantity"`
-	CountryId       string           `json:"countryId"`
+	Id             string `json:"id"`
+	Quantity       string `json:"quantity"` // exact decimal, see quantity.go
+	Unit           string `json:"unit"`     // kg, lb, litres, units or cases
+	CountryId      string `json:"countryId"`
+	LotNumber      string `json:"lotNumber,omitempty"`
+	ProductionDate string `json:"productionDate,omitempty"` // YYYY-MM-DD
+	BestBefore     string `json:"bestBefore,omitempty"`     // YYYY-MM-DD, expired goods cannot be listed or transferred
+	Category       string `json:"category,omitempty"`       // eg shellfish, matched against each country's risk policy
+	Gtin           string `json:"gtin,omitempty"`           // GTIN-14, see fields.go
+	Description    string `json:"description,omitempty"`
+	Supplier       string `json:"supplier,omitempty"`  // supplier that created the product, the only one who can list it
+	ListingId      string `json:"listingId,omitempty"` // listing the product was last put in, see init_product_listing()
 	// Temperature 			string
 	// Owner      OwnerRelation `json:"owner"`
 }
@@ -58,49 +60,239 @@ type Product struct {
 // Participants
 // TODO, inheriting from User might be unnecessary
 type User struct {
-  firstName string
-  lastName string
-  middleName string
-	Id				string
-  Type      string
+	ObjectType string `json:"docType"` //field for couchdb
+	Id         string
+	Type       string
+	Profile    Profile          `json:"profile"`              // legal name, contact details and address, see profile.go
+	Identity   *IdentityBinding `json:"identity,omitempty"`   // certificate the participant acts with, see identity.go
+	Suspension *SuspensionEvent `json:"suspension,omitempty"` // suspension in force or coming into force, see suspension.go
 }
 
 type Retailer struct {
-    User
-    Id       string          `json:"id"`
-    Products []string        `json:"products"` // making this a list of product ids
-    // Products []Product        `json:"products"`
+	User
+	Id       string   `json:"id"`
+	Products []string `json:"products"` // making this a list of product ids
+	// Products []Product        `json:"products"`
+	Holdings map[string]string `json:"holdings,omitempty"` // product id -> quantity held, in the product's unit
+	StockSeq int               `json:"stockSeq,omitempty"` // sequence of the last StockMovement recorded for this retailer
 }
 
 type Importer struct {
-    User
-    Id       string          `json:"id"`
+	User
+	Id        string `json:"id"`
+	CountryId string `json:"countryId"` // listings transferred to the importer are destined for this country
 }
 
 type Supplier struct {
-    User
-    Id       string          `json:"id"`
-    countryId       string           `json:"countryid"`
-    orgId       string           `json:"orgId"`
+	User
+	Id        string `json:"id"`
+	CountryId string `json:"countryId"`
+	OrgId     string `json:"orgId"`
+}
+
+// Customs broker, acts for importers that delegated to it, see delegation.go
+type Broker struct {
+	User
+	Id            string `json:"id"`
+	LicenseNumber string `json:"licenseNumber"`
 }
 
 type Regulator struct {
-    Id       string          `json:"id"`
-    countryId       string           `json:"countryid"`
-    ExemptedOrgIds       []string           `json:"exemptedorgids"`
-    ExemptedProductIds       []string           `json:"exemptedproductids"`
+	ObjectType string           `json:"docType"` //field for couchdb
+	Id         string           `json:"id"`
+	Type       string           `json:"Type"`      // always "regulator"
+	CountryId  string           `json:"countryId"` // jurisdiction
+	Profile    Profile          `json:"profile"`
+	Identity   *IdentityBinding `json:"identity,omitempty"`
+}
+
+// What a participant tells the others about itself, kept up to date with update_user, see profile.go
+type Profile struct {
+	LegalName  string  `json:"legalName"`
+	FirstName  string  `json:"firstName"` // contact person
+	MiddleName string  `json:"middleName"`
+	LastName   string  `json:"lastName"`
+	Email      string  `json:"email"`
+	Phone      string  `json:"phone"`
+	Address    Address `json:"address"`
+}
+
+type Address struct {
+	Street     string `json:"street"`
+	City       string `json:"city"`
+	Region     string `json:"region"`
+	PostalCode string `json:"postalCode"`
+	CountryId  string `json:"countryId"`
+}
+
+// Identity allowed to run the maintenance functions, see admin.go
+type Administrator struct {
+	Id      string `json:"id"` // certificate common name
+	MSPId   string `json:"mspId"`
+	SetTxId string `json:"setTxId"`
+}
+
+// One operation the administrator ran
+type AdminAuditEntry struct {
+	TxId      string   `json:"txId"`
+	AdminId   string   `json:"adminId"`
+	MSPId     string   `json:"mspId"`
+	Function  string   `json:"function"`
+	Args      []string `json:"args"`
+	Timestamp string   `json:"timestamp"` // RFC 3339, of the transaction
+}
+
+// Exemptions in force in a country, shared by all of its regulators
+type Jurisdiction struct {
+	CountryId          string      `json:"countryId"`
+	ExemptedOrgIds     []string    `json:"exemptedorgids"`
+	ExemptedProductIds []string    `json:"exemptedproductids"`
+	HighRisk           *RiskPolicy `json:"highRisk,omitempty"` // listings that need several regulators to sign off, see sign_off.go
+}
+
+// What makes a listing high risk in a country, and who signs it off
+type RiskPolicy struct {
+	Categories []string `json:"categories"` // product categories
+	Origins    []string `json:"origins"`    // product countries of origin
+	Panel      []string `json:"panel"`      // regulator ids
+	Quorum     int      `json:"quorum"`     // approvals needed from the panel
+}
+
+// Enrolled certificate a participant is bound to
+type IdentityBinding struct {
+	MSPId              string `json:"mspId"`
+	Subject            string `json:"subject"`
+	Issuer             string `json:"issuer"`
+	Fingerprint        string `json:"fingerprint"` // hex sha256 of the DER certificate
+	BoundTxId          string `json:"boundTxId"`
+	PendingFingerprint string `json:"pendingFingerprint,omitempty"` // reissued certificate waiting to take over, see rotate_identity()
 }
 
 // Products
 type ProductListingContract struct {
-    Id       string          `json:"id"` // listingId
-    Status   string           `json:"status"`
-    Products []string        `json:"products"` // making this a list of product ids
-    // Owner    User            `json:"owner"`
-		Owner    string            `json:"owner"`
-    OwnerType    string            `json:"ownertype"` // is this necessary?
-		Supplier string        `json:"supplier"`
-    // Supplier Supplier        `json:"supplier"`
+	ObjectType string        `json:"docType"` //field for couchdb
+	Id         string        `json:"id"`      // listingId
+	Status     ListingStatus `json:"status"`
+	Products   []string      `json:"products"` // making this a list of product ids
+	// Owner    User            `json:"owner"`
+	Owner     string `json:"owner"`
+	OwnerType string `json:"ownertype"` // is this necessary?
+	Supplier  string `json:"supplier"`
+	// Supplier Supplier        `json:"supplier"`
+	HazardReportId     string              `json:"hazardReportId,omitempty"` // latest HazardAnalysisReport submitted for this listing
+	Rejection          *ListingRejection   `json:"rejection,omitempty"`
+	Disposition        *ListingDisposition `json:"disposition,omitempty"`
+	Allocations        map[string]string   `json:"allocations,omitempty"`        // product id -> quantity in this listing when it is not the whole product
+	ParentId           string              `json:"parentId,omitempty"`           // listing this one was split from
+	ChildIds           []string            `json:"childIds,omitempty"`           // listings split from this one
+	ConsignmentId      string              `json:"consignmentId,omitempty"`      // consignment the listing is checked with
+	DestinationCountry string              `json:"destinationCountry,omitempty"` // country of the importer, only its regulators can check the listing
+	DelegatedAction    *DelegatedAction    `json:"delegatedAction,omitempty"`    // set when the holder's latest change was made by its broker
+	SignOff            *SignOff            `json:"signOff,omitempty"`            // set when the listing was found high risk
+}
+
+// Regulators' sign off of a high risk listing
+type SignOff struct {
+	Quorum  int           `json:"quorum"`
+	Panel   []string      `json:"panel"`
+	Reasons []string      `json:"reasons"` // why the listing is high risk
+	Votes   []SignOffVote `json:"votes"`
+}
+
+type SignOffVote struct {
+	RegulatorId string `json:"regulatorId"`
+	Decision    string `json:"decision"` // APPROVE or REJECT
+	Reason      string `json:"reason,omitempty"`
+	TxId        string `json:"txId"`
+}
+
+// Operations an importer lets a broker invoke in its name
+type Delegation struct {
+	PrincipalId string   `json:"principalId"` // importer
+	AgentId     string   `json:"agentId"`     // broker
+	Operations  []string `json:"operations"`
+	ValidFrom   string   `json:"validFrom"`  // YYYY-MM-DD
+	ValidUntil  string   `json:"validUntil"` // YYYY-MM-DD, inclusive
+	Revoked     bool     `json:"revoked"`
+	GrantedTxId string   `json:"grantedTxId"`
+	RevokedTxId string   `json:"revokedTxId,omitempty"`
+}
+
+// Change a broker made in an importer's name
+type DelegatedAction struct {
+	PrincipalId string `json:"principalId"`
+	AgentId     string `json:"agentId"`
+	Function    string `json:"function"`
+	TxId        string `json:"txId"`
+}
+
+// A regulator suspending or reinstating a participant
+type SuspensionEvent struct {
+	ParticipantId string `json:"participantId"`
+	Seq           int    `json:"seq"`
+	Action        string `json:"action"` // SUSPENDED or REINSTATED
+	RegulatorId   string `json:"regulatorId"`
+	Reason        string `json:"reason"`
+	EffectiveDate string `json:"effectiveDate"` // YYYY-MM-DD
+	TxId          string `json:"txId"`
+}
+
+// One entry in a retailer's stock ledger
+type StockMovement struct {
+	RetailerId string `json:"retailerId"`
+	Seq        int    `json:"seq"`
+	ProductId  string `json:"productId"`
+	Type       string `json:"type"` // RECEIVED, SOLD, DISPOSED or WRITTEN_OFF
+	Quantity   string `json:"quantity"`
+	Unit       string `json:"unit"`
+	Balance    string `json:"balance"`   // held after this movement
+	Reference  string `json:"reference"` // listing id for receipts, receipt number or reason otherwise
+	TxId       string `json:"txId"`
+}
+
+// Several suppliers' listings cleared together in one customs entry
+type Consignment struct {
+	ObjectType      string           `json:"docType"` //field for couchdb
+	Id              string           `json:"id"`
+	ImporterId      string           `json:"importerId"`
+	ListingIds      []string         `json:"listingIds"`
+	Status          ListingStatus    `json:"status"` // EXEMPTCHECKREQ until checked, then the combined verdict
+	CheckedBy       string           `json:"checkedBy,omitempty"`
+	Checks          []ExemptionCheck `json:"checks,omitempty"`          // verdict for each listing
+	DelegatedAction *DelegatedAction `json:"delegatedAction,omitempty"` // set when a broker created it for the importer
+}
+
+// Regulator's decision to refuse a consignment
+type ListingRejection struct {
+	RegulatorId       string `json:"regulatorId"`
+	Reason            string `json:"reason"`
+	CorrectionAllowed bool   `json:"correctionAllowed"` // may the importer release the goods once corrected
+	TxId              string `json:"txId"`
+}
+
+// What the importer did with a refused consignment
+type ListingDisposition struct {
+	ImporterId string        `json:"importerId"`
+	Outcome    ListingStatus `json:"outcome"`
+	Reference  string        `json:"reference"` // export declaration, destruction certificate, corrective action record...
+	TxId       string        `json:"txId"`
+}
+
+// Hazard analysis the importer submits for a listing flagged by the regulator
+type HazardAnalysisReport struct {
+	ObjectType         string           `json:"docType"` //field for couchdb
+	Id                 string           `json:"id"`
+	ListingId          string           `json:"listingId"`
+	ImporterId         string           `json:"importerId"`
+	DocumentHash       string           `json:"documentHash"` // sha256 of the full report, which is kept off chain
+	HazardsIdentified  []string         `json:"hazardsIdentified"`
+	PreventiveControls []string         `json:"preventiveControls"`
+	LabReferences      []string         `json:"labReferences"`
+	Status             string           `json:"status"` // SUBMITTED, APPROVED or REJECTED
+	SubmittedTxId      string           `json:"submittedTxId"`
+	ReviewedBy         string           `json:"reviewedBy,omitempty"`
+	ReviewComment      string           `json:"reviewComment,omitempty"`
+	DelegatedAction    *DelegatedAction `json:"delegatedAction,omitempty"` // set when a broker submitted it for the importer
 }
 
 // write functions for transactions
@@ -109,7 +301,6 @@ type ProductListingContract struct {
 // transferListing
 // change Owner field in ProductListingContract
 
-
 // // Importer --> Regulator w/o hazard analysis i.e. iniitial check. onSuccess transfer assests to retailer on failure send back to importer for hazard analysis
 // // Importer --> Regulator with hazard analysis. Assumes the Importer has sent the hazard analysis report to Regulator. onSuccess transfer assests to retailer
 // transaction  checkProducts{
@@ -117,10 +308,6 @@ type ProductListingContract struct {
 //   --> ProductListingContract productListing
 // }
 
-
-
-
-
 // // ----- Owners ----- //
 // type Owner struct {
 // 	ObjectType string `json:"docType"`     //field for couchdb
@@ -146,7 +333,6 @@ func main() {
 	}
 }
 
-
 // ============================================================================================================================
 // Init - initialize the chaincode
 //
@@ -157,7 +343,12 @@ func main() {
 // Shows off GetTxID() to get the transaction ID of the proposal
 //
 // Inputs - Array of strings
-//  ["314"]
+//
+//	  0   ,       1        ,        2
+//	["314", "deny"/"allow" , "admin"    ]
+//
+// The access control mode defaults to deny, see acl.go. The administrator defaults to whoever instantiates the
+// chaincode and is kept on later runs unless named again, see admin.go.
 //
 // Returns - shim.Success or error
 // ============================================================================================================================
@@ -174,8 +365,12 @@ func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	fmt.Println("  GetFunctionAndParameters() args count:", len(args))
 	fmt.Println("  GetFunctionAndParameters() args found:", args)
 
-	// expecting 1 arg for instantiate or upgrade
-	if len(args) == 1 {
+	if len(args) > 3 {
+		return shim.Error("Incorrect number of arguments. Expecting a number, optionally the access control mode and the administrator")
+	}
+
+	// expecting 1 arg for instantiate or upgrade, and optionally the access control mode and administrator
+	if len(args) >= 1 {
 		fmt.Println("  GetFunctionAndParameters() arg[0] length", len(args[0]))
 
 		// expecting arg[0] to be length 0 for upgrade
@@ -194,11 +389,41 @@ func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 			// it's handy to read this right away to verify network is healthy if it wrote the correct value
 			err = stub.PutState("selftest", []byte(strconv.Itoa(number)))
 			if err != nil {
-				return shim.Error(err.Error())                  //self-test fail
+				return shim.Error(err.Error()) //self-test fail
 			}
 		}
 	}
 
+	// "deny" (the default) or "allow" to keep permissions.acl's Default rule, see acl.go
+	if len(args) >= 2 {
+		if args[1] != AclModeDeny && args[1] != AclModeAllow {
+			return shim.Error("Expecting access control mode \"deny\" or \"allow\"")
+		}
+		err = stub.PutState(aclModeKey, []byte(args[1]))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	// administrator for the maintenance functions, see admin.go
+	adminId := ""
+	if len(args) == 3 {
+		err = check_field("administrator", "id", args[2])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		adminId = args[2]
+	}
+	admin, err := set_admin(stub, adminId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("  Administrator:", admin.Id, admin.MSPId)
+	err = record_admin_audit(stub, "init", args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// showing the alternative argument shim function
 	alt := stub.GetStringArgs()
 	fmt.Println("  GetStringArgs() args count:", len(alt))
@@ -210,11 +435,10 @@ func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 		return shim.Error(err.Error())
 	}
 
-	fmt.Println("Ready for action")                          //self-test pass
+	fmt.Println("Ready for action") //self-test pass
 	return shim.Success(nil)
 }
 
-
 // ============================================================================================================================
 // Invoke - Our entry point for Invocations
 // ============================================================================================================================
@@ -223,51 +447,152 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	fmt.Println(" ")
 	fmt.Println("invoking function - " + function)
 
+	// settings and indexes cannot be overwritten, see admin.go
+	err := check_protected_keys(function, args)
+	if err != nil {
+		fmt.Println(err.Error())
+		return shim.Error(err.Error())
+	}
+	// ids, countries, dates, quantities... see fields.go
+	err = check_arguments(function, args)
+	if err != nil {
+		fmt.Println(err.Error())
+		return shim.Error(err.Error())
+	}
+	// maintenance functions are the administrator's alone
+	if is_admin_function(function) {
+		err = check_admin(stub, function, args)
+		if err != nil {
+			fmt.Println(err.Error())
+			return shim.Error(err.Error())
+		}
+	} else {
+		// role check, see roles.go
+		err = check_role(stub, function)
+		if err != nil {
+			fmt.Println(err.Error())
+			return shim.Error(err.Error())
+		}
+		// access control rules, see acl.go
+		err = check_acl(stub, function, args)
+		if err != nil {
+			fmt.Println(err.Error())
+			return shim.Error(err.Error())
+		}
+	}
+
 	// Handle different functions
-	if function == "init" {                    //initialize the chaincode state, used as reset
+	if function == "init" { //initialize the chaincode state, used as reset
 		return t.Init(stub)
-	} else if function == "read" {             //generic read ledger
+	} else if function == "read" { //generic read ledger
 		return read(stub, args)
-	} else if function == "write" {            //generic writes to ledger
+	} else if function == "write" { //generic writes to ledger
 		return write(stub, args)
-	} else if function == "init_product" {      //create a new marble
+	} else if function == "migrate_keys" { //move entities stored under plain ids to their namespaced keys
+		return migrate_keys(stub, args)
+	} else if function == "confirm_identity" { //name the certificate an unbound participant will bind to
+		return confirm_identity(stub, args)
+	} else if function == "init_product" { //create a new marble
 		return init_product(stub, args)
-	} else if function == "init_product_listing" {      //create a new marble
+	} else if function == "init_product_listing" { //create a new marble
 		return init_product_listing(stub, args)
-	} else if function == "init_user"{        //create a new marble owner
+	} else if function == "init_user" { //create a new marble owner
 		return init_user(stub, args)
-  } else if function == "init_regulator" {        //change owner of a marble
+	} else if function == "init_regulator" { //change owner of a marble
 		return init_regulator(stub, args)
-	} else if function == "transfer_product_listing" {        //change owner of a marble
+	} else if function == "rotate_identity" { //move a participant to a reissued certificate
+		return rotate_identity(stub, args)
+	} else if function == "update_user" { //participant updates its profile
+		return update_user(stub, args)
+	} else if function == "transfer_product_listing" { //change owner of a marble
 		return transfer_product_listing(stub, args)
-	} else if function == "check_products" {        //change owner of a marble
+	} else if function == "check_products" { //change owner of a marble
 		return check_products(stub, args)
-	} else if function == "read_everything"{   //read everything, (owners + marbles + companies)
+	} else if function == "update_exempted_list" { //add, remove or replace the exempted orgs/products of a regulator's country
+		return update_exempted_list(stub, args)
+	} else if function == "submit_hazard_analysis" { //importer files a hazard analysis for a flagged listing
+		return submit_hazard_analysis(stub, args)
+	} else if function == "approve_hazard_analysis" { //regulator clears a listing on its hazard analysis
+		return approve_hazard_analysis(stub, args)
+	} else if function == "reject_hazard_analysis" { //regulator sends a hazard analysis back to the importer
+		return reject_hazard_analysis(stub, args)
+	} else if function == "set_risk_policy" { //regulator sets which listings need several regulators to sign off
+		return set_risk_policy(stub, args)
+	} else if function == "sign_off_listing" { //panel regulator approves or rejects a high risk listing
+		return sign_off_listing(stub, args)
+	} else if function == "reject_listing" { //regulator refuses a listing
+		return reject_listing(stub, args)
+	} else if function == "record_disposition" { //importer closes out a refused listing
+		return record_disposition(stub, args)
+	} else if function == "split_product_listing" { //importer splits a cleared listing across retailers
+		return split_product_listing(stub, args)
+	} else if function == "init_consignment" { //importer groups listings for one combined check
+		return init_consignment(stub, args)
+	} else if function == "sell_product" { //retailer records a sale
+		return consume_stock(stub, args, StockSold)
+	} else if function == "dispose_product" { //retailer records disposal of damaged or recalled stock
+		return consume_stock(stub, args, StockDisposed)
+	} else if function == "write_off_product" { //retailer records stock lost or written off
+		return consume_stock(stub, args, StockWrittenOff)
+	} else if function == "grant_delegation" { //importer lets a broker act in its name
+		return grant_delegation(stub, args)
+	} else if function == "revoke_delegation" { //importer withdraws a broker's delegation
+		return revoke_delegation(stub, args)
+	} else if function == "suspend_participant" { //regulator suspends a supplier, importer, retailer or broker
+		return suspend_participant(stub, args)
+	} else if function == "reinstate_participant" { //regulator lifts a suspension
+		return reinstate_participant(stub, args)
+	} else if function == "read_everything" { //read everything, (owners + marbles + companies)
 		return read_everything(stub)
-	} else if function == "getHistory"{        //read history of a marble (audit)
+	} else if function == "query" { //find entities of one type with a CouchDB selector
+		return query(stub, args)
+	} else if function == "get_listing_totals" { //read the quantity totals of a listing
+		return get_listing_totals(stub, args)
+	} else if function == "get_retailer_totals" { //read the quantity totals a retailer holds
+		return get_retailer_totals(stub, args)
+	} else if function == "get_listing_lineage" { //read the listings a listing was split from and into
+		return get_listing_lineage(stub, args)
+	} else if function == "get_expiring_products" { //read products a retailer holds that are nearing expiry
+		return get_expiring_products(stub, args)
+	} else if function == "get_stock_ledger" { //read a retailer's stock movements
+		return get_stock_ledger(stub, args)
+	} else if function == "getHistory" { //read history of a marble (audit)
 		return getHistory(stub, args)
-  }
+	} else if function == "get_listing_transitions" { //read the actions a listing can take next
+		return get_listing_transitions(stub, args)
+	} else if function == "get_user" { //read a participant as the type it registered as
+		return read_user(stub, args)
+	} else if function == "get_caller_role" { //read the caller's role and what it may invoke
+		return get_caller_role(stub, args)
+	} else if function == "get_schema" { //read the JSON Schema of the documents the init functions take
+		return get_schema(stub, args)
+	} else if function == "get_delegations" { //read the delegations an importer granted
+		return get_delegations(stub, args)
+	} else if function == "get_delegated_actions" { //read what brokers did in an importer's name
+		return get_delegated_actions(stub, args)
+	} else if function == "get_suspension_history" { //read a participant's suspensions and reinstatements
+		return get_suspension_history(stub, args)
+	} else if function == "get_admin_audit" { //read every operation the administrator ran
+		return get_admin_audit(stub, args)
+	} else if function == "get_exemptions" { //read the orgs and products exempted in a country
+		return get_exemptions(stub, args)
+	}
 	// } else if function == "getMarblesByRange"{ //read a bunch of marbles by start and stop id
 	// 	return getMarblesByRange(stub, args)
 	// } else if function == "disable_owner"{     //disable a marble owner from appearing on the UI
 	// 	return disable_owner(stub, args)
 
-
-
-  // create product
-  // create user (type required...retailer, importer, or supplier)
-  // create regulator (not inherited from user)
-  // transfer product listing
-  // check products
-  // update exempted list
-
+	// create product
+	// create user (type required...retailer, importer, or supplier)
+	// create regulator (not inherited from user)
+	// transfer product listing
+	// check products
 
 	// error out
 	fmt.Println("Received unknown invoke function name - " + function)
 	return shim.Error("Received unknown invoke function name - '" + function + "'")
 }
 
-
 // ============================================================================================================================
 // Query - legacy function
 // ============================================================================================================================
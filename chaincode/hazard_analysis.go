@@ -0,0 +1,255 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	ReportSubmitted = "SUBMITTED"
+	ReportApproved  = "APPROVED"
+	ReportRejected  = "REJECTED"
+)
+
+// ============================================================================================================================
+// Get Hazard Analysis Report - get a hazard analysis report from ledger
+// ============================================================================================================================
+func get_hazard_report(stub shim.ChaincodeStubInterface, id string) (HazardAnalysisReport, error) {
+	var report HazardAnalysisReport
+	reportAsBytes, err := get_entity_state(stub, hazardReportNamespace, id)
+	if err != nil {
+		return report, errors.New("Failed to find hazard analysis report - " + id)
+	}
+	json.Unmarshal(reportAsBytes, &report)
+
+	if report.Id != id || len(report.ListingId) == 0 {
+		return report, errors.New("Hazard analysis report does not exist - " + id)
+	}
+
+	return report, nil
+}
+
+// ============================================================================================================================
+// Submit Hazard Analysis - importer files a hazard analysis report for a listing flagged by check_products()
+//
+// Inputs - Array of strings
+//
+//	    0     ,      1     ,      2     ,       3       ,        4         ,           5          ,        6
+//	report id ,  listing id, importer id, document hash , hazards (JSON)   , preventive controls  , lab references
+//	                                       sha256 hex     ["Listeria"]       ["Cold chain < 4C"]    ["LAB-2018-0042"]
+//
+// ============================================================================================================================
+func submit_hazard_analysis(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting submit_hazard_analysis")
+
+	if len(args) != 7 {
+		return shim.Error("Incorrect number of arguments. Expecting 7. report id, listing id, importer id, document hash, hazards, preventive controls and lab references")
+	}
+
+	var report HazardAnalysisReport
+	report.Id = args[0]
+	report.ListingId = args[1]
+	report.ImporterId = args[2]
+	report.DocumentHash = strings.ToLower(args[3])
+	report.Status = ReportSubmitted
+	report.SubmittedTxId = stub.GetTxID()
+
+	documentHash, err := hex.DecodeString(report.DocumentHash)
+	if err != nil || len(documentHash) != 32 {
+		return shim.Error("Document hash must be a hex encoded sha256 digest")
+	}
+	report.HazardsIdentified, err = parse_string_list(args[4], "Hazards identified")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	report.PreventiveControls, err = parse_string_list(args[5], "Preventive controls")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	report.LabReferences, err = parse_string_list(args[6], "Lab references")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(report.HazardsIdentified) > 0 && len(report.PreventiveControls) == 0 {
+		return shim.Error("Every hazard analysis identifying hazards must list preventive controls")
+	}
+
+	existingAsBytes, err := get_entity_state(stub, hazardReportNamespace, report.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existingAsBytes != nil {
+		return shim.Error("This id already exists - " + report.Id)
+	}
+
+	report.DelegatedAction, err = act_for(stub, report.ImporterId, "submit_hazard_analysis")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	productListing, err := get_product_listing(stub, report.ListingId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if productListing.Owner != report.ImporterId {
+		return shim.Error("Only the importer holding listing " + productListing.Id + " can submit its hazard analysis")
+	}
+
+	err = transition_listing(&productListing, ActionSubmitHazard, StatusHazardAnalysisReview)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	productListing.HazardReportId = report.Id
+	productListing.DelegatedAction = report.DelegatedAction
+
+	err = put_hazard_report(stub, report)
+	if err != nil {
+		fmt.Println("Could not store hazard analysis report")
+		return shim.Error(err.Error())
+	}
+	err = put_product_listing(stub, productListing)
+	if err != nil {
+		fmt.Println("Could not store product listing")
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end submit_hazard_analysis")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Approve Hazard Analysis - regulator accepts the report, the only way a flagged listing reaches CHECKCOMPLETED
+//
+// A high risk listing goes on to SIGNOFFREQ instead, see sign_off.go
+//
+// Inputs - Array of strings
+//
+//	    0     ,       1      ,     2
+//	report id , regulator id , comment (optional)
+//
+// ============================================================================================================================
+func approve_hazard_analysis(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting approve_hazard_analysis")
+
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting report id, regulator id and an optional comment")
+	}
+	comment := ""
+	if len(args) == 3 {
+		comment = args[2]
+	}
+
+	err := review_hazard_analysis(stub, args[0], args[1], ReportApproved, comment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end approve_hazard_analysis")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Reject Hazard Analysis - regulator refuses the report, the importer has to submit a new one
+//
+// Inputs - Array of strings
+//
+//	    0     ,       1      ,   2
+//	report id , regulator id , reason
+//
+// ============================================================================================================================
+func reject_hazard_analysis(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting reject_hazard_analysis")
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3. report id, regulator id and reason")
+	}
+	if len(strings.TrimSpace(args[2])) == 0 {
+		return shim.Error("A reason is required to reject a hazard analysis")
+	}
+
+	err := review_hazard_analysis(stub, args[0], args[1], ReportRejected, args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end reject_hazard_analysis")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// review_hazard_analysis() - record the regulator's decision on the report and move its listing on
+// ============================================================================================================================
+func review_hazard_analysis(stub shim.ChaincodeStubInterface, report_id string, regulator_id string, decision string, comment string) error {
+	report, err := get_hazard_report(stub, report_id)
+	if err != nil {
+		return err
+	}
+	if report.Status != ReportSubmitted {
+		return errors.New("Hazard analysis report " + report.Id + " has already been " + strings.ToLower(report.Status))
+	}
+
+	regulator, err := get_regulator(stub, regulator_id)
+	if err != nil {
+		return err
+	}
+	err = assert_caller(stub, regulator_id)
+	if err != nil {
+		return err
+	}
+
+	productListing, err := get_product_listing(stub, report.ListingId)
+	if err != nil {
+		return err
+	}
+	if productListing.HazardReportId != report.Id {
+		return errors.New("Hazard analysis report " + report.Id + " is not the current report for listing " + productListing.Id)
+	}
+	err = check_jurisdiction(regulator, productListing)
+	if err != nil {
+		return err
+	}
+
+	if decision == ReportApproved {
+		err = transition_listing(&productListing, ActionApproveHazard, cleared_status(productListing))
+	} else {
+		err = transition_listing(&productListing, ActionRejectHazard, StatusHazardAnalysisCheckReq)
+	}
+	if err != nil {
+		return err
+	}
+
+	report.Status = decision
+	report.ReviewedBy = regulator.Id
+	report.ReviewComment = comment
+
+	err = put_hazard_report(stub, report)
+	if err != nil {
+		return err
+	}
+	return put_product_listing(stub, productListing)
+}
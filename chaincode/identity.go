@@ -0,0 +1,392 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Caller Identity - who signed the transaction
+//
+// A participant registers itself with init_user / init_regulator using a certificate whose common name is its id, ie
+// participant "importer1" is registered with the CA with enrollment id "importer1". Registration binds the participant
+// to that certificate (MSP, subject, fingerprint) and from then on only that certificate can act for it, until the
+// binding is moved to a reissued certificate with rotate_identity(). Write functions acting for a participant call
+// assert_caller(), which refuses participants that are not bound yet.
+//
+// The composite key identity~fingerprint maps a bound certificate back to its participant.
+// ============================================================================================================================
+
+const (
+	identityIndex        = "identity"
+	identityConfirmIndex = "identityconfirm" // certificate the administrator confirmed for an unbound participant
+)
+
+// ============================================================================================================================
+// read_caller_certificate() - binding for the certificate that signed the transaction, and its common name
+// ============================================================================================================================
+func read_caller_certificate(stub shim.ChaincodeStubInterface) (IdentityBinding, string, error) {
+	var binding IdentityBinding
+	cert, err := cid.GetX509Certificate(stub)
+	if err != nil {
+		return binding, "", errors.New("Could not read the caller's certificate - " + err.Error())
+	}
+	if cert == nil || len(cert.Subject.CommonName) == 0 {
+		return binding, "", errors.New("Caller's certificate has no common name")
+	}
+	binding.MSPId, err = cid.GetMSPID(stub)
+	if err != nil {
+		return binding, "", errors.New("Could not read the caller's MSP - " + err.Error())
+	}
+	fingerprint := sha256.Sum256(cert.Raw)
+	binding.Fingerprint = hex.EncodeToString(fingerprint[:])
+	binding.Subject = cert.Subject.String()
+	binding.Issuer = cert.Issuer.String()
+	binding.BoundTxId = stub.GetTxID()
+	return binding, cert.Subject.CommonName, nil
+}
+
+// ============================================================================================================================
+// get_bound_participant() - participant id a certificate fingerprint is bound to, empty if none
+// ============================================================================================================================
+func get_bound_participant(stub shim.ChaincodeStubInterface, fingerprint string) (string, error) {
+	indexKey, err := stub.CreateCompositeKey(identityIndex, []string{fingerprint})
+	if err != nil {
+		return "", err
+	}
+	idAsBytes, err := stub.GetState(indexKey)
+	if err != nil {
+		return "", err
+	}
+	return string(idAsBytes), nil
+}
+
+// ============================================================================================================================
+// get_identity_binding() - certificate binding of any participant, nil if the participant has none
+// ============================================================================================================================
+func get_identity_binding(stub shim.ChaincodeStubInterface, id string) (*IdentityBinding, error) {
+	var participant struct {
+		Identity *IdentityBinding `json:"identity"`
+	}
+	participantAsBytes, err := get_entity_state(stub, participantNamespace, id)
+	if err != nil {
+		return nil, errors.New("Failed to get participant - " + id)
+	}
+	if participantAsBytes == nil {
+		return nil, nil
+	}
+	json.Unmarshal(participantAsBytes, &participant)
+	return participant.Identity, nil
+}
+
+// ============================================================================================================================
+// put_identity_binding() - replace the binding on a stored participant, whatever type of participant it is
+// ============================================================================================================================
+func put_identity_binding(stub shim.ChaincodeStubInterface, id string, binding IdentityBinding) error {
+	var participant map[string]json.RawMessage
+	participantAsBytes, err := get_entity_state(stub, participantNamespace, id)
+	if err != nil {
+		return errors.New("Failed to get participant - " + id)
+	}
+	err = json.Unmarshal(participantAsBytes, &participant)
+	if err != nil || participant == nil {
+		return errors.New("Participant does not exist - " + id)
+	}
+	participant["identity"], _ = json.Marshal(binding)
+	participantAsBytes, _ = json.Marshal(participant)
+	return put_entity_state(stub, participantNamespace, id, participantAsBytes)
+}
+
+// ============================================================================================================================
+// get_caller_id() - participant id of the transaction creator
+//
+// The participant its certificate is bound to, or the certificate's common name if it is not bound yet
+// ============================================================================================================================
+func get_caller_id(stub shim.ChaincodeStubInterface) (string, error) {
+	caller, commonName, err := read_caller_certificate(stub)
+	if err != nil {
+		return "", err
+	}
+	boundId, err := get_bound_participant(stub, caller.Fingerprint)
+	if err != nil {
+		return "", err
+	}
+	if len(boundId) > 0 {
+		return boundId, nil
+	}
+	return commonName, nil
+}
+
+// ============================================================================================================================
+// assert_caller() - refuse unless the transaction was signed by the certificate bound to participant id
+//
+// A participant with no binding cannot act until it registers, see bind_caller().
+// ============================================================================================================================
+func assert_caller(stub shim.ChaincodeStubInterface, id string) error {
+	caller, commonName, err := read_caller_certificate(stub)
+	if err != nil {
+		return err
+	}
+	boundId, err := get_bound_participant(stub, caller.Fingerprint)
+	if err != nil {
+		return err
+	}
+	if len(boundId) > 0 {
+		if boundId != id {
+			return errors.New("Caller " + boundId + " cannot act as " + id)
+		}
+		return nil
+	}
+
+	if commonName != id {
+		return errors.New("Caller " + commonName + " cannot act as " + id)
+	}
+	binding, err := get_identity_binding(stub, id)
+	if err != nil {
+		return err
+	}
+	if binding != nil {
+		return errors.New("Caller's certificate is not the one bound to " + id + ", move the binding with rotate_identity")
+	}
+	return errors.New("Participant " + id + " is not bound to a certificate, register with init_user or init_regulator first")
+}
+
+// ============================================================================================================================
+// bind_caller() - binding for a participant registering itself, and index the certificate to it
+//
+// Re-registering with the bound certificate keeps the binding. A participant registered before certificates were
+// bound can be claimed by any certificate with its common name, so its first binding needs the certificate confirmed
+// by the administrator with confirm_identity().
+// ============================================================================================================================
+func bind_caller(stub shim.ChaincodeStubInterface, id string) (*IdentityBinding, error) {
+	caller, commonName, err := read_caller_certificate(stub)
+	if err != nil {
+		return nil, err
+	}
+	boundId, err := get_bound_participant(stub, caller.Fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	if len(boundId) > 0 && boundId != id {
+		return nil, errors.New("Caller " + boundId + " cannot act as " + id)
+	}
+	if len(boundId) == 0 && commonName != id {
+		return nil, errors.New("Caller " + commonName + " cannot act as " + id)
+	}
+	existing, err := get_identity_binding(stub, id)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if existing.Fingerprint != caller.Fingerprint {
+			return nil, errors.New("Caller's certificate is not the one bound to " + id + ", move the binding with rotate_identity")
+		}
+		return existing, nil
+	}
+
+	participantAsBytes, err := get_entity_state(stub, participantNamespace, id)
+	if err != nil {
+		return nil, errors.New("Failed to get participant - " + id)
+	}
+	if participantAsBytes != nil {
+		confirmKey, err := stub.CreateCompositeKey(identityConfirmIndex, []string{id})
+		if err != nil {
+			return nil, err
+		}
+		confirmed, err := stub.GetState(confirmKey)
+		if err != nil {
+			return nil, err
+		}
+		if string(confirmed) != caller.Fingerprint {
+			return nil, errors.New("Participant " + id + " was registered before certificates were bound, the administrator must confirm its certificate with confirm_identity")
+		}
+		err = stub.DelState(confirmKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	indexKey, err := stub.CreateCompositeKey(identityIndex, []string{caller.Fingerprint})
+	if err != nil {
+		return nil, err
+	}
+	err = stub.PutState(indexKey, []byte(id))
+	if err != nil {
+		return nil, err
+	}
+	return &caller, nil
+}
+
+// ============================================================================================================================
+// Confirm Identity - name the certificate a participant registered before certificates were bound will bind to
+//
+// The participant then registers again with init_user or init_regulator from that certificate. Administrator only.
+//
+// Inputs - Array of strings
+//
+//	      0        ,                    1
+//	participant id , certificate fingerprint - hex sha256 of the DER certificate
+//	 "importer1"   , "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+//
+// ============================================================================================================================
+func confirm_identity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting confirm_identity")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting participant id and certificate fingerprint")
+	}
+	id := args[0]
+	fingerprint := strings.ToLower(args[1])
+
+	participantAsBytes, err := get_entity_state(stub, participantNamespace, id)
+	if err != nil {
+		return shim.Error("Failed to get participant - " + id)
+	}
+	if participantAsBytes == nil {
+		return shim.Error("Participant does not exist - " + id)
+	}
+	binding, err := get_identity_binding(stub, id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if binding != nil {
+		return shim.Error("Participant " + id + " is already bound to a certificate, move the binding with rotate_identity")
+	}
+	boundId, err := get_bound_participant(stub, fingerprint)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(boundId) > 0 {
+		return shim.Error("Certificate is already bound to " + boundId)
+	}
+
+	confirmKey, err := stub.CreateCompositeKey(identityConfirmIndex, []string{id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(confirmKey, []byte(fingerprint))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end confirm_identity")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Rotate Identity - move a participant to a reissued certificate, in two steps
+//
+//  1. the bound certificate names the fingerprint of the new certificate
+//  2. the new certificate confirms, taking over the binding
+//
+// Inputs - Array of strings
+//
+//	      0        ,                    1
+//	participant id , new certificate fingerprint - hex sha256 of the DER certificate, step 1 only
+//	 "importer1"   , "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+//
+// Returns - the participant's binding
+// ============================================================================================================================
+func rotate_identity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting rotate_identity")
+
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting participant id and, from the bound certificate, the new certificate fingerprint")
+	}
+	id := args[0]
+
+	binding, err := get_identity_binding(stub, id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if binding == nil {
+		return shim.Error("Participant " + id + " is not bound to a certificate")
+	}
+	caller, _, err := read_caller_certificate(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(args) == 2 {
+		// step 1, from the bound certificate
+		err = assert_caller(stub, id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		pending := strings.ToLower(args[1])
+		fingerprint, err := hex.DecodeString(pending)
+		if err != nil || len(fingerprint) != sha256.Size {
+			return shim.Error("New certificate fingerprint must be a hex encoded sha256 digest")
+		}
+		if pending == binding.Fingerprint {
+			return shim.Error("Participant " + id + " is already bound to that certificate")
+		}
+		boundId, err := get_bound_participant(stub, pending)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if len(boundId) > 0 {
+			return shim.Error("That certificate is already bound to " + boundId)
+		}
+		binding.PendingFingerprint = pending
+	} else {
+		// step 2, from the new certificate
+		if len(binding.PendingFingerprint) == 0 || caller.Fingerprint != binding.PendingFingerprint {
+			return shim.Error("Caller's certificate has not been named by " + id + " to take over its binding")
+		}
+		oldKey, err := stub.CreateCompositeKey(identityIndex, []string{binding.Fingerprint})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = stub.DelState(oldKey)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		newKey, err := stub.CreateCompositeKey(identityIndex, []string{caller.Fingerprint})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = stub.PutState(newKey, []byte(id))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		binding = &caller
+	}
+
+	err = put_identity_binding(stub, id, *binding)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	bindingAsBytes, _ := json.Marshal(binding)
+	fmt.Println("- end rotate_identity")
+	return shim.Success(bindingAsBytes)
+}
@@ -0,0 +1,149 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Jurisdiction - a listing is destined for its importer's country and only that country's regulators can check, review
+// or reject it. Exempted orgs and products are kept per country under the composite key jurisdiction~country.
+// ============================================================================================================================
+
+const jurisdictionIndex = "jurisdiction"
+
+// ============================================================================================================================
+// get_jurisdiction() - exemptions in force in a country, empty lists if none have been set
+// ============================================================================================================================
+func get_jurisdiction(stub shim.ChaincodeStubInterface, countryId string) (Jurisdiction, error) {
+	jurisdiction := Jurisdiction{CountryId: countryId, ExemptedOrgIds: []string{}, ExemptedProductIds: []string{}}
+	jurisdictionKey, err := stub.CreateCompositeKey(jurisdictionIndex, []string{countryId})
+	if err != nil {
+		return jurisdiction, err
+	}
+	jurisdictionAsBytes, err := stub.GetState(jurisdictionKey)
+	if err != nil {
+		return jurisdiction, errors.New("Failed to get jurisdiction - " + countryId)
+	}
+	if jurisdictionAsBytes != nil {
+		json.Unmarshal(jurisdictionAsBytes, &jurisdiction)
+	}
+	return jurisdiction, nil
+}
+
+func put_jurisdiction(stub shim.ChaincodeStubInterface, jurisdiction Jurisdiction) ([]byte, error) {
+	jurisdictionKey, err := stub.CreateCompositeKey(jurisdictionIndex, []string{jurisdiction.CountryId})
+	if err != nil {
+		return nil, err
+	}
+	jurisdictionAsBytes, _ := json.Marshal(jurisdiction)
+	return jurisdictionAsBytes, stub.PutState(jurisdictionKey, jurisdictionAsBytes)
+}
+
+// ============================================================================================================================
+// migrate_regulator_exemptions() - move the exemptions a regulator's record kept before they were kept per country into
+// the jurisdiction of countryId
+//
+// A regulator registered by an older version has no country, so this runs when it registers again with one.
+// ============================================================================================================================
+func migrate_regulator_exemptions(stub shim.ChaincodeStubInterface, regulatorId string, countryId string) error {
+	var legacy struct {
+		ExemptedOrgIds     []string `json:"exemptedorgids"`
+		ExemptedProductIds []string `json:"exemptedproductids"`
+	}
+	regulatorAsBytes, err := get_entity_state(stub, participantNamespace, regulatorId)
+	if err != nil {
+		return errors.New("Failed to get regulator - " + regulatorId)
+	}
+	if regulatorAsBytes == nil {
+		return nil
+	}
+	json.Unmarshal(regulatorAsBytes, &legacy)
+	if len(legacy.ExemptedOrgIds) == 0 && len(legacy.ExemptedProductIds) == 0 {
+		return nil
+	}
+
+	jurisdiction, err := get_jurisdiction(stub, countryId)
+	if err != nil {
+		return err
+	}
+	for _, orgId := range legacy.ExemptedOrgIds {
+		if !contains_string(jurisdiction.ExemptedOrgIds, orgId) {
+			jurisdiction.ExemptedOrgIds = append(jurisdiction.ExemptedOrgIds, orgId)
+		}
+	}
+	for _, productId := range legacy.ExemptedProductIds {
+		if !contains_string(jurisdiction.ExemptedProductIds, productId) {
+			jurisdiction.ExemptedProductIds = append(jurisdiction.ExemptedProductIds, productId)
+		}
+	}
+	fmt.Println("moving exemptions of regulator " + regulatorId + " to jurisdiction " + countryId)
+	_, err = put_jurisdiction(stub, jurisdiction)
+	return err
+}
+
+// ============================================================================================================================
+// check_jurisdiction() - refuse unless the regulator regulates the country the listing is destined for
+// ============================================================================================================================
+func check_jurisdiction(regulator Regulator, listing ProductListingContract) error {
+	if len(regulator.CountryId) == 0 {
+		return errors.New("Regulator " + regulator.Id + " has no country, register it again with init_regulator")
+	}
+	if len(listing.DestinationCountry) == 0 {
+		return errors.New("Listing " + listing.Id + " has no destination country")
+	}
+	if regulator.CountryId != listing.DestinationCountry {
+		return errors.New("Regulator " + regulator.Id + " regulates " + regulator.CountryId + ", listing " + listing.Id +
+			" is destined for " + listing.DestinationCountry)
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Get Exemptions - the orgs and products exempted in a country
+//
+// Inputs - Array of strings
+//
+//	    0
+//	country id
+//	  "US"
+//
+// ============================================================================================================================
+func get_exemptions(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting get_exemptions")
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting country id")
+	}
+
+	jurisdiction, err := get_jurisdiction(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	jurisdictionAsBytes, _ := json.Marshal(jurisdiction)
+	fmt.Println("- end get_exemptions")
+	return shim.Success(jurisdictionAsBytes)
+}
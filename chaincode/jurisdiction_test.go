@@ -0,0 +1,104 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckJurisdiction(t *testing.T) {
+	cases := []struct {
+		regulator Regulator
+		listing   ProductListingContract
+		allowed   bool
+	}{
+		{Regulator{Id: "regulator1", CountryId: "US"}, ProductListingContract{Id: "l1", DestinationCountry: "US"}, true},
+		{Regulator{Id: "regulator1", CountryId: "US"}, ProductListingContract{Id: "l1", DestinationCountry: "CA"}, false},
+		{Regulator{Id: "regulator1", CountryId: "US"}, ProductListingContract{Id: "l1"}, false}, // listed before destinations were recorded
+		{Regulator{Id: "regulator1"}, ProductListingContract{Id: "l1", DestinationCountry: "US"}, false},
+		{Regulator{Id: "regulator1"}, ProductListingContract{Id: "l1"}, false},
+		{Regulator{Id: "regulator1", CountryId: "us"}, ProductListingContract{Id: "l1", DestinationCountry: "US"}, false},
+	}
+	for _, c := range cases {
+		err := check_jurisdiction(c.regulator, c.listing)
+		if (err == nil) != c.allowed {
+			t.Errorf("regulator of %q checks listing for %q: got %v, want allowed=%v", c.regulator.CountryId, c.listing.DestinationCountry, err, c.allowed)
+		}
+	}
+}
+
+type jurisdictionStub struct {
+	aclStateStub
+}
+
+func (stub jurisdictionStub) PutState(key string, value []byte) error {
+	stub.state[key] = value
+	return nil
+}
+
+// exemptions an older regulator record kept are merged into its country's, once
+func TestMigrateRegulatorExemptions(t *testing.T) {
+	stub := jurisdictionStub{aclStateStub{state: map[string][]byte{}}}
+	put := func(id string, record string) {
+		key, _ := stub.CreateCompositeKey(participantNamespace, []string{id})
+		stub.state[key] = []byte(record)
+	}
+	put("oldregulator", `{"Id": "oldregulator", "exemptedorgids": ["org1", "org2"], "exemptedproductids": ["p1"]}`)
+	put("newregulator", `{"Id": "newregulator", "Type": "regulator", "CountryId": "US"}`)
+	put("emptyregulator", `{"Id": "emptyregulator", "exemptedorgids": []}`)
+	_, err := put_jurisdiction(stub, Jurisdiction{CountryId: "US", ExemptedOrgIds: []string{"org2", "org3"}, ExemptedProductIds: []string{}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	cases := []struct {
+		regulatorId string
+		countryId   string
+		orgIds      []string
+		productIds  []string
+	}{
+		{"newregulator", "US", []string{"org2", "org3"}, []string{}},
+		{"emptyregulator", "US", []string{"org2", "org3"}, []string{}},
+		{"unknownregulator", "US", []string{"org2", "org3"}, []string{}},
+		{"oldregulator", "US", []string{"org2", "org3", "org1"}, []string{"p1"}},
+		{"oldregulator", "US", []string{"org2", "org3", "org1"}, []string{"p1"}}, // registering again adds nothing
+		{"oldregulator", "CA", []string{"org1", "org2"}, []string{"p1"}},
+	}
+	for _, c := range cases {
+		if err := migrate_regulator_exemptions(stub, c.regulatorId, c.countryId); err != nil {
+			t.Errorf("%s to %s: %s", c.regulatorId, c.countryId, err.Error())
+			continue
+		}
+		jurisdiction, err := get_jurisdiction(stub, c.countryId)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !reflect.DeepEqual(jurisdiction.ExemptedOrgIds, c.orgIds) || !reflect.DeepEqual(jurisdiction.ExemptedProductIds, c.productIds) {
+			t.Errorf("%s to %s: orgs %q products %q, want %q %q", c.regulatorId, c.countryId,
+				jurisdiction.ExemptedOrgIds, jurisdiction.ExemptedProductIds, c.orgIds, c.productIds)
+		}
+	}
+
+	jurisdiction, _ := get_jurisdiction(stub, "GB")
+	if jurisdiction.CountryId != "GB" || jurisdiction.ExemptedOrgIds == nil || jurisdiction.ExemptedProductIds == nil {
+		t.Errorf("a country without exemptions should have empty lists, got %+v", jurisdiction)
+	}
+}
@@ -0,0 +1,232 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Keys - every entity is stored under a composite key namespaced by its type, eg product~product1
+//
+// A product and a retailer can share an id without one overwriting the other, and read_everything lists each type with
+// a partial composite key query instead of guessing id prefixes. Participants share one namespace: their id is the
+// common name of the certificate they act with, whatever their role.
+//
+// Read and write entities with the typed helpers below (get_product / put_product, get_supplier / put_participant...),
+// the *_state helpers are for the code that edits a participant record field by field.
+//
+// Every entity is written with its namespace as its docType, which the CouchDB indexes in META-INF and query() use.
+// ============================================================================================================================
+
+const (
+	productNamespace      = "product"
+	listingNamespace      = "listing"
+	participantNamespace  = "participant"
+	hazardReportNamespace = "hazardreport"
+	consignmentNamespace  = "consignment"
+)
+
+// namespaces read() and migrate_keys() accept
+var entityNamespaces = []string{productNamespace, listingNamespace, participantNamespace, hazardReportNamespace, consignmentNamespace}
+
+func entity_key(stub shim.ChaincodeStubInterface, namespace string, id string) (string, error) {
+	if len(id) == 0 {
+		return "", errors.New("Missing " + namespace + " id")
+	}
+	return stub.CreateCompositeKey(namespace, []string{id})
+}
+
+// ============================================================================================================================
+// get_entity_state() / put_entity_state() - the stored bytes of an entity, nil if there is none
+// ============================================================================================================================
+func get_entity_state(stub shim.ChaincodeStubInterface, namespace string, id string) ([]byte, error) {
+	key, err := entity_key(stub, namespace, id)
+	if err != nil {
+		return nil, err
+	}
+	return stub.GetState(key)
+}
+
+func put_entity_state(stub shim.ChaincodeStubInterface, namespace string, id string, value []byte) error {
+	key, err := entity_key(stub, namespace, id)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, value)
+}
+
+func put_entity(stub shim.ChaincodeStubInterface, namespace string, id string, entity interface{}) error {
+	entityAsBytes, err := json.Marshal(entity)
+	if err != nil {
+		return err
+	}
+	entityAsBytes, err = with_doc_type(namespace, entityAsBytes)
+	if err != nil {
+		return err
+	}
+	return put_entity_state(stub, namespace, id, entityAsBytes)
+}
+
+// with_doc_type() - the record with its docType set to the namespace it is stored in
+func with_doc_type(namespace string, recordAsBytes []byte) ([]byte, error) {
+	var record map[string]json.RawMessage
+	err := json.Unmarshal(recordAsBytes, &record)
+	if err != nil {
+		return nil, err
+	}
+	record["docType"], _ = json.Marshal(namespace)
+	return json.Marshal(record)
+}
+
+// ============================================================================================================================
+// Typed puts - the getters are in lib.go, hazard_analysis.go and consignment.go
+// ============================================================================================================================
+func put_product(stub shim.ChaincodeStubInterface, product Product) error {
+	return put_entity(stub, productNamespace, product.Id, product)
+}
+
+func put_product_listing(stub shim.ChaincodeStubInterface, productListing ProductListingContract) error {
+	return put_entity(stub, listingNamespace, productListing.Id, productListing)
+}
+
+func put_hazard_report(stub shim.ChaincodeStubInterface, report HazardAnalysisReport) error {
+	return put_entity(stub, hazardReportNamespace, report.Id, report)
+}
+
+func put_consignment(stub shim.ChaincodeStubInterface, consignment Consignment) error {
+	return put_entity(stub, consignmentNamespace, consignment.Id, consignment)
+}
+
+// Supplier, Importer, Retailer, Broker or Regulator
+type Participant interface {
+	participant_id() string
+}
+
+func (user User) participant_id() string {
+	return user.Id
+}
+
+func (regulator Regulator) participant_id() string {
+	return regulator.Id
+}
+
+func put_participant(stub shim.ChaincodeStubInterface, participant Participant) error {
+	return put_entity(stub, participantNamespace, participant.participant_id(), participant)
+}
+
+// ============================================================================================================================
+// record_namespace() - which namespace a stored record belongs in, from its fields, "" if it is not an entity
+// ============================================================================================================================
+func record_namespace(record map[string]json.RawMessage) string {
+	if _, ok := record["ownertype"]; ok {
+		return listingNamespace
+	}
+	if _, ok := record["hazardsIdentified"]; ok {
+		return hazardReportNamespace
+	}
+	if _, ok := record["listingIds"]; ok {
+		return consignmentNamespace
+	}
+	var userType string
+	json.Unmarshal(record["Type"], &userType)
+	if _, ok := userResources[userType]; ok || userType == RoleRegulator {
+		return participantNamespace
+	}
+	if _, ok := record["exemptedorgids"]; ok { // regulator from before participants had a Type
+		return participantNamespace
+	}
+	if _, ok := record["quantity"]; ok {
+		return productNamespace
+	}
+	return ""
+}
+
+// ============================================================================================================================
+// Migrate Keys - move entities stored under their plain id, before keys were namespaced, to their composite keys
+//
+// Run once by the administrator after upgrading a ledger written by an older version. Records that are not entities,
+// such as the chaincode's settings, are left where they are. Safe to run again.
+//
+// Inputs - none
+// Returns - the ids moved, by namespace
+// ============================================================================================================================
+func migrate_keys(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting migrate_keys")
+
+	if len(args) != 0 {
+		return shim.Error("Incorrect number of arguments. Expecting 0")
+	}
+
+	// a range query over every plain key, composite keys are not included
+	resultsIterator, err := stub.GetStateByRange("", "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	moved := map[string][]string{}
+	for resultsIterator.HasNext() {
+		aKeyValue, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if is_protected_key(aKeyValue.Key) {
+			continue
+		}
+		var record map[string]json.RawMessage
+		if json.Unmarshal(aKeyValue.Value, &record) != nil {
+			continue
+		}
+		namespace := record_namespace(record)
+		if len(namespace) == 0 {
+			continue
+		}
+		existing, err := get_entity_state(stub, namespace, aKeyValue.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if existing != nil {
+			return shim.Error("Cannot move " + aKeyValue.Key + ", " + namespace + " " + aKeyValue.Key + " already exists")
+		}
+		recordAsBytes, err := with_doc_type(namespace, aKeyValue.Value)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = put_entity_state(stub, namespace, aKeyValue.Key, recordAsBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = stub.DelState(aKeyValue.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		moved[namespace] = append(moved[namespace], aKeyValue.Key)
+	}
+
+	movedAsBytes, _ := json.Marshal(moved)
+	fmt.Println("- end migrate_keys")
+	return shim.Success(movedAsBytes)
+}
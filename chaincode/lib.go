@@ -22,7 +22,7 @@ package main
 import (
 	"encoding/json"
 	"errors"
-	"strconv"
+	"strings"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 )
@@ -32,29 +32,47 @@ import (
 // ============================================================================================================================
 func get_product(stub shim.ChaincodeStubInterface, id string) (Product, error) {
 	var product Product
-	productAsBytes, err := stub.GetState(id)                  //getState retreives a key/value from the ledger
-	if err != nil {                                          //this seems to always succeed, even if key didn't exist
+	productAsBytes, err := get_entity_state(stub, productNamespace, id) //getState retreives a key/value from the ledger
+	if err != nil {                                                     //this seems to always succeed, even if key didn't exist
 		return product, errors.New("Failed to find product - " + id)
 	}
-	json.Unmarshal(productAsBytes, &product)                   //un stringify it aka JSON.parse()
+	json.Unmarshal(productAsBytes, &product) //un stringify it aka JSON.parse()
 
-	if product.Id != id {                                     //test if product is actually here or just nil
+	if product.Id != id { //test if product is actually here or just nil
 		return product, errors.New("Product does not exist - " + id)
 	}
 
 	return product, nil
 }
 
+// ============================================================================================================================
+// Get Product Listing - get a product listing contract from ledger
+// ============================================================================================================================
+func get_product_listing(stub shim.ChaincodeStubInterface, id string) (ProductListingContract, error) {
+	var productListing ProductListingContract
+	productListingAsBytes, err := get_entity_state(stub, listingNamespace, id) //getState retreives a key/value from the ledger
+	if err != nil {                                                            //this seems to always succeed, even if key didn't exist
+		return productListing, errors.New("Failed to find product listing - " + id)
+	}
+	json.Unmarshal(productListingAsBytes, &productListing) //un stringify it aka JSON.parse()
+
+	if productListing.Id != id { //test if listing is actually here or just nil
+		return productListing, errors.New("Product listing does not exist - " + id)
+	}
+
+	return productListing, nil
+}
+
 // ============================================================================================================================
 // Get Owner - get the owner product from ledger
 // ============================================================================================================================
 func get_user(stub shim.ChaincodeStubInterface, id string) (User, error) {
 	var user User
-	userAsBytes, err := stub.GetState(id)                     //getState retreives a key/value from the ledger
-	if err != nil {                                            //this seems to always succeed, even if key didn't exist
+	userAsBytes, err := get_entity_state(stub, participantNamespace, id) //getState retreives a key/value from the ledger
+	if err != nil {                                                      //this seems to always succeed, even if key didn't exist
 		return user, errors.New("Failed to get User - " + id)
 	}
-	json.Unmarshal(userAsBytes, &user)                       //un stringify it aka JSON.parse()
+	json.Unmarshal(userAsBytes, &user) //un stringify it aka JSON.parse()
 
 	// if len(user.id) == 0 {                              //test if owner is actually here or just nil
 	// 	return user, errors.New("User does not exist - " + id )
@@ -63,15 +81,76 @@ func get_user(stub shim.ChaincodeStubInterface, id string) (User, error) {
 	return user, nil
 }
 
+func get_supplier(stub shim.ChaincodeStubInterface, id string) (Supplier, error) {
+	var supplier Supplier
+	supplierAsBytes, err := get_entity_state(stub, participantNamespace, id) //getState retreives a key/value from the ledger
+	if err != nil {                                                          //this seems to always succeed, even if key didn't exist
+		return supplier, errors.New("Failed to get Supplier - " + id)
+	}
+	json.Unmarshal(supplierAsBytes, &supplier) //un stringify it aka JSON.parse()
+
+	if supplier.User.Id != id || supplier.User.Type != "supplier" { //test if supplier is actually here or just nil
+		return supplier, errors.New("Supplier does not exist - " + id)
+	}
+
+	return supplier, nil
+}
+
+func get_importer(stub shim.ChaincodeStubInterface, id string) (Importer, error) {
+	var importer Importer
+	importerAsBytes, err := get_entity_state(stub, participantNamespace, id) //getState retreives a key/value from the ledger
+	if err != nil {                                                          //this seems to always succeed, even if key didn't exist
+		return importer, errors.New("Failed to get Importer - " + id)
+	}
+	json.Unmarshal(importerAsBytes, &importer) //un stringify it aka JSON.parse()
+
+	if importer.User.Id != id || importer.User.Type != "importer" { //test if importer is actually here or just nil
+		return importer, errors.New("Importer does not exist - " + id)
+	}
+
+	return importer, nil
+}
+
+func get_broker(stub shim.ChaincodeStubInterface, id string) (Broker, error) {
+	var broker Broker
+	brokerAsBytes, err := get_entity_state(stub, participantNamespace, id) //getState retreives a key/value from the ledger
+	if err != nil {                                                        //this seems to always succeed, even if key didn't exist
+		return broker, errors.New("Failed to get Broker - " + id)
+	}
+	json.Unmarshal(brokerAsBytes, &broker) //un stringify it aka JSON.parse()
+
+	if broker.User.Id != id || broker.User.Type != "broker" { //test if broker is actually here or just nil
+		return broker, errors.New("Broker does not exist - " + id)
+	}
+
+	return broker, nil
+}
+
+func get_retailer(stub shim.ChaincodeStubInterface, id string) (Retailer, error) {
+	var retailer Retailer
+	retailerAsBytes, err := get_entity_state(stub, participantNamespace, id) //getState retreives a key/value from the ledger
+	if err != nil {                                                          //this seems to always succeed, even if key didn't exist
+		return retailer, errors.New("Failed to get Retailer - " + id)
+	}
+	json.Unmarshal(retailerAsBytes, &retailer) //un stringify it aka JSON.parse()
+
+	if retailer.User.Id != id || retailer.User.Type != "retailer" { //test if retailer is actually here or just nil
+		return retailer, errors.New("Retailer does not exist - " + id)
+	}
+
+	return retailer, nil
+}
+
 func get_regulator(stub shim.ChaincodeStubInterface, id string) (Regulator, error) {
 	var regulator Regulator
-	regulatorAsBytes, err := stub.GetState(id)                     //getState retreives a key/value from the ledger
-	if err != nil {                                            //this seems to always succeed, even if key didn't exist
+	regulatorAsBytes, err := get_entity_state(stub, participantNamespace, id) //getState retreives a key/value from the ledger
+	if err != nil {                                                           //this seems to always succeed, even if key didn't exist
 		return regulator, errors.New("Failed to get Regulator - " + id)
 	}
-	json.Unmarshal(regulatorAsBytes, &regulator)                       //un stringify it aka JSON.parse()
+	json.Unmarshal(regulatorAsBytes, &regulator) //un stringify it aka JSON.parse()
 
-	if len(regulator.Id) == 0 {                              //test if owner is actually here or just nil
+	// regulators registered before Type was recorded have none
+	if regulator.Id != id || (len(regulator.Type) > 0 && regulator.Type != RoleRegulator) {
 		return regulator, errors.New("Regulator does not exist - " + id)
 	}
 
@@ -79,16 +158,44 @@ func get_regulator(stub shim.ChaincodeStubInterface, id string) (Regulator, erro
 }
 
 // ========================================================
-// Input Sanitation - dumb input checking, look for empty strings
+// String list helpers
 // ========================================================
-func sanitize_arguments(strs []string) error{
-	for i, val:= range strs {
-		if len(val) <= 0 {
-			return errors.New("Argument " + strconv.Itoa(i) + " must be a non-empty string")
+func contains_string(list []string, val string) bool {
+	for _, item := range list {
+		if item == val {
+			return true
 		}
-		if len(val) > 32 {
-			return errors.New("Argument " + strconv.Itoa(i) + " must be <= 32 characters")
+	}
+	return false
+}
+
+// keeps the first occurrence of each value, in order
+func dedupe_strings(list []string) []string {
+	var unique []string
+	for _, item := range list {
+		if !contains_string(unique, item) {
+			unique = append(unique, item)
+		}
+	}
+	return unique
+}
+
+// ========================================================
+// Parse String List - parse an argument holding a JSON array of strings
+// ========================================================
+func parse_string_list(arg string, name string) ([]string, error) {
+	var list []string
+	err := json.Unmarshal([]byte(arg), &list)
+	if err != nil {
+		return nil, errors.New(name + " must be a JSON array of strings")
+	}
+	for _, item := range list {
+		if len(strings.TrimSpace(item)) == 0 {
+			return nil, errors.New(name + " must not contain empty strings")
 		}
 	}
-	return nil
+	if list == nil {
+		list = []string{}
+	}
+	return list, nil
 }
@@ -0,0 +1,282 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Split Product Listing - importer breaks a cleared listing into child listings, e.g. one per retailer
+//
+// Children inherit the parent's status and clearance and are then transferred on their own. Whatever is not handed
+// out stays on the parent; once nothing is left the parent becomes SPLIT.
+//
+// Inputs - Array of strings
+//
+//	     0            ,      1      ,         2
+//	listing id        , importer id , children (JSON)
+//
+// "productlistingcontract1", "importer1" , [{"id": "productlistingcontract1a", "allocations": {"product1": "100"}},
+//
+//	{"id": "productlistingcontract1b", "allocations": {"product1": "50", "product2": "10"}}]
+//
+// allocations are in each product's own unit of measure
+// ============================================================================================================================
+func split_product_listing(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	type ChildSpec struct {
+		Id          string            `json:"id"`
+		Allocations map[string]string `json:"allocations"`
+	}
+	var err error
+	var children []ChildSpec
+	fmt.Println("starting split_product_listing")
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3. listing id, importer id and children")
+	}
+
+	err = json.Unmarshal([]byte(args[2]), &children)
+	if err != nil {
+		return shim.Error("Children must be a JSON array of {\"id\", \"allocations\"} objects")
+	}
+	if len(children) == 0 {
+		return shim.Error("Expecting at least one child listing")
+	}
+
+	parent, err := get_product_listing(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if parent.Owner != args[1] {
+		return shim.Error("Only the importer holding listing " + parent.Id + " can split it")
+	}
+	delegatedAction, err := act_for(stub, args[1], "split_product_listing")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = check_not_suspended(stub, parent.Owner)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = check_listing_action(parent, ActionSplitListing, "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = check_not_expired(stub, parent.Products)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// what the parent has to hand out
+	remaining := map[string]*big.Rat{}
+	units := map[string]string{}
+	for _, productId := range parent.Products {
+		quantity, unit, err := listing_product_quantity(stub, parent, productId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		remaining[productId] = quantity
+		units[productId] = unit
+	}
+
+	var childListings []ProductListingContract
+	var childIds []string
+	for _, spec := range children {
+		err = check_field("child id", "id", spec.Id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if contains_string(childIds, spec.Id) || spec.Id == parent.Id {
+			return shim.Error("Child listing id " + spec.Id + " is used more than once")
+		}
+		existingAsBytes, err := get_entity_state(stub, listingNamespace, spec.Id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if existingAsBytes != nil {
+			return shim.Error("This id already exists - " + spec.Id)
+		}
+		// check_products() takes a listing or a consignment id, so they must not share one
+		_, err = get_consignment(stub, spec.Id)
+		if err == nil {
+			return shim.Error("This id is already used by a consignment - " + spec.Id)
+		}
+		if len(spec.Allocations) == 0 {
+			return shim.Error("Child listing " + spec.Id + " must carry at least one product")
+		}
+
+		// children stay in the parent's jurisdiction and keep the evidence it was cleared on
+		child := ProductListingContract{
+			ObjectType:         parent.ObjectType,
+			Id:                 spec.Id,
+			Status:             parent.Status,
+			Owner:              parent.Owner,
+			OwnerType:          parent.OwnerType,
+			Supplier:           parent.Supplier,
+			HazardReportId:     parent.HazardReportId,
+			Rejection:          parent.Rejection,
+			Disposition:        parent.Disposition,
+			Allocations:        map[string]string{},
+			ParentId:           parent.Id,
+			DestinationCountry: parent.DestinationCountry,
+			DelegatedAction:    delegatedAction,
+			SignOff:            parent.SignOff,
+		}
+
+		var productIds []string
+		for productId := range spec.Allocations {
+			productIds = append(productIds, productId)
+		}
+		sort.Strings(productIds)
+		for _, productId := range productIds {
+			available, ok := remaining[productId]
+			if !ok {
+				return shim.Error("Product " + productId + " is not in listing " + parent.Id)
+			}
+			quantity, err := parse_quantity(spec.Allocations[productId], units[productId])
+			if err != nil {
+				return shim.Error("Child listing " + spec.Id + ", product " + productId + " - " + err.Error())
+			}
+			if quantity.Cmp(available) > 0 {
+				return shim.Error("Cannot allocate " + format_decimal(quantity) + " " + units[productId] + " of product " + productId +
+					", only " + format_decimal(available) + " left in listing " + parent.Id)
+			}
+			available.Sub(available, quantity)
+			child.Products = append(child.Products, productId)
+			child.Allocations[productId] = format_decimal(quantity)
+		}
+
+		childIds = append(childIds, child.Id)
+		childListings = append(childListings, child)
+	}
+
+	// the parent keeps whatever was not allocated
+	kept := []string{}
+	parent.Allocations = map[string]string{}
+	for _, productId := range parent.Products {
+		if remaining[productId].Sign() > 0 {
+			kept = append(kept, productId)
+			parent.Allocations[productId] = format_decimal(remaining[productId])
+		}
+	}
+	parent.Products = kept
+	parent.ChildIds = append(parent.ChildIds, childIds...)
+	parent.DelegatedAction = delegatedAction
+	if len(kept) == 0 {
+		parent.Allocations = nil
+		err = transition_listing(&parent, ActionSplitListing, StatusSplit)
+	} else {
+		err = transition_listing(&parent, ActionSplitListing, parent.Status)
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	for _, child := range childListings {
+		err = put_product_listing(stub, child)
+		if err != nil {
+			fmt.Println("Could not store child listing")
+			return shim.Error(err.Error())
+		}
+	}
+	err = put_product_listing(stub, parent)
+	if err != nil {
+		fmt.Println("Could not store product listing")
+		return shim.Error(err.Error())
+	}
+
+	parentAsBytes, _ := json.Marshal(parent)
+	fmt.Println("- end split_product_listing")
+	return shim.Success(parentAsBytes)
+}
+
+// ============================================================================================================================
+// Get Listing Lineage - the listings a listing was split from and everything split from it since
+//
+// Inputs - Array of strings
+//
+//	     0
+//	listing id
+//
+// "productlistingcontract1a"
+//
+// Returns:
+//
+//	{
+//		"id": "productlistingcontract1a",
+//		"ancestors": ["productlistingcontract1"],
+//		"descendants": [{"id": "productlistingcontract1a1", "parentId": "productlistingcontract1a", "status": "CHECKCOMPLETED", "owner": "retailer1"}]
+//	}
+//
+// ============================================================================================================================
+func get_listing_lineage(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	type Descendant struct {
+		Id       string        `json:"id"`
+		ParentId string        `json:"parentId"`
+		Status   ListingStatus `json:"status"`
+		Owner    string        `json:"owner"`
+	}
+	type Lineage struct {
+		Id          string       `json:"id"`
+		Ancestors   []string     `json:"ancestors"`   // closest first
+		Descendants []Descendant `json:"descendants"` // breadth first
+	}
+	fmt.Println("starting get_listing_lineage")
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1, the listing id")
+	}
+
+	listing, err := get_product_listing(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	lineage := Lineage{Id: listing.Id, Ancestors: []string{}, Descendants: []Descendant{}}
+
+	for parentId := listing.ParentId; len(parentId) > 0; {
+		parent, err := get_product_listing(stub, parentId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		lineage.Ancestors = append(lineage.Ancestors, parent.Id)
+		parentId = parent.ParentId
+	}
+
+	queue := listing.ChildIds
+	for len(queue) > 0 {
+		child, err := get_product_listing(stub, queue[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		queue = append(queue[1:], child.ChildIds...)
+		lineage.Descendants = append(lineage.Descendants, Descendant{child.Id, child.ParentId, child.Status, child.Owner})
+	}
+
+	lineageAsBytes, _ := json.Marshal(lineage)
+	fmt.Println("- end get_listing_lineage")
+	return shim.Success(lineageAsBytes)
+}
@@ -0,0 +1,296 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Listing Status - lifecycle of a ProductListingContract
+// ============================================================================================================================
+
+type ListingStatus string
+
+const (
+	StatusInitialRequest         ListingStatus = "INITIALREQUEST"
+	StatusExemptCheckReq         ListingStatus = "EXEMPTCHECKREQ"
+	StatusHazardAnalysisCheckReq ListingStatus = "HAZARDANALYSISCHECKREQ"
+	StatusHazardAnalysisReview   ListingStatus = "HAZARDANALYSISREVIEW"
+	StatusSignOffReq             ListingStatus = "SIGNOFFREQ" // high risk, waiting for a quorum of regulators
+	StatusCheckCompleted         ListingStatus = "CHECKCOMPLETED"
+	StatusRejected               ListingStatus = "REJECTED"
+	StatusSplit                  ListingStatus = "SPLIT" // every product has been handed to child listings
+
+	// dispositions of a rejected listing
+	StatusReExported              ListingStatus = "RE_EXPORTED"
+	StatusDestroyed               ListingStatus = "DESTROYED"
+	StatusReleasedAfterCorrection ListingStatus = "RELEASED_AFTER_CORRECTION"
+)
+
+// every listing starts life here, see init_product_listing()
+const listingInitialStatus = StatusInitialRequest
+
+type ListingAction string
+
+const (
+	ActionTransferToImporter ListingAction = "transfer_to_importer"
+	ActionTransferToRetailer ListingAction = "transfer_to_retailer"
+	ActionCheckProducts      ListingAction = "check_products"
+	ActionSubmitHazard       ListingAction = "submit_hazard_analysis"
+	ActionApproveHazard      ListingAction = "approve_hazard_analysis"
+	ActionRejectHazard       ListingAction = "reject_hazard_analysis"
+	ActionRejectListing      ListingAction = "reject_listing"
+	ActionRecordDisposition  ListingAction = "record_disposition"
+	ActionSplitListing       ListingAction = "split_product_listing"
+	ActionSignOff            ListingAction = "sign_off_listing"
+)
+
+// machine readable reasons a transition is refused
+const (
+	ReasonUnknownStatus     = "UNKNOWN_STATUS"
+	ReasonUnknownAction     = "UNKNOWN_ACTION"
+	ReasonIllegalTransition = "ILLEGAL_TRANSITION"
+	ReasonWrongHolder       = "WRONG_HOLDER"
+	ReasonInConsignment     = "IN_CONSIGNMENT"
+)
+
+type ListingTransition struct {
+	Action ListingAction `json:"action"`
+	From   ListingStatus `json:"from"`
+	To     ListingStatus `json:"to"`
+	Holder string        `json:"holder"` // OwnerType the listing must have for the move
+}
+
+// ============================================================================================================================
+// Transition table - the only moves a listing is allowed to make. Every write function goes through transition_listing()
+// ============================================================================================================================
+var listingTransitions = []ListingTransition{
+	{ActionTransferToImporter, StatusInitialRequest, StatusExemptCheckReq, "Supplier"},
+	{ActionCheckProducts, StatusExemptCheckReq, StatusCheckCompleted, "Importer"},
+	{ActionCheckProducts, StatusExemptCheckReq, StatusHazardAnalysisCheckReq, "Importer"},
+	{ActionSubmitHazard, StatusHazardAnalysisCheckReq, StatusHazardAnalysisReview, "Importer"},
+	{ActionApproveHazard, StatusHazardAnalysisReview, StatusCheckCompleted, "Importer"},
+	{ActionRejectHazard, StatusHazardAnalysisReview, StatusHazardAnalysisCheckReq, "Importer"},
+	{ActionCheckProducts, StatusExemptCheckReq, StatusSignOffReq, "Importer"},
+	{ActionApproveHazard, StatusHazardAnalysisReview, StatusSignOffReq, "Importer"},
+	{ActionSignOff, StatusSignOffReq, StatusSignOffReq, "Importer"},
+	{ActionSignOff, StatusSignOffReq, StatusCheckCompleted, "Importer"},
+	{ActionSignOff, StatusSignOffReq, StatusRejected, "Importer"},
+	{ActionTransferToRetailer, StatusCheckCompleted, StatusCheckCompleted, "Importer"},
+	{ActionRejectListing, StatusExemptCheckReq, StatusRejected, "Importer"},
+	{ActionRejectListing, StatusHazardAnalysisCheckReq, StatusRejected, "Importer"},
+	{ActionRejectListing, StatusHazardAnalysisReview, StatusRejected, "Importer"},
+	{ActionRejectListing, StatusSignOffReq, StatusRejected, "Importer"},
+	{ActionRecordDisposition, StatusRejected, StatusReExported, "Importer"},
+	{ActionRecordDisposition, StatusRejected, StatusDestroyed, "Importer"},
+	{ActionRecordDisposition, StatusRejected, StatusReleasedAfterCorrection, "Importer"},
+	{ActionTransferToRetailer, StatusReleasedAfterCorrection, StatusReleasedAfterCorrection, "Importer"},
+	{ActionSplitListing, StatusCheckCompleted, StatusCheckCompleted, "Importer"},
+	{ActionSplitListing, StatusCheckCompleted, StatusSplit, "Importer"},
+	{ActionSplitListing, StatusReleasedAfterCorrection, StatusReleasedAfterCorrection, "Importer"},
+	{ActionSplitListing, StatusReleasedAfterCorrection, StatusSplit, "Importer"},
+}
+
+type TransitionError struct {
+	Reason    string        `json:"reason"`
+	ListingId string        `json:"listingId"`
+	Action    ListingAction `json:"action"`
+	From      ListingStatus `json:"from"`
+	To        ListingStatus `json:"to,omitempty"`
+	Holder    string        `json:"holder"`
+	Required  string        `json:"requiredHolder,omitempty"`
+	Message   string        `json:"message"`
+}
+
+// the error text is JSON so clients can switch on "reason"
+func (e *TransitionError) Error() string {
+	errAsBytes, _ := json.Marshal(e)
+	return string(errAsBytes)
+}
+
+func is_known_status(status ListingStatus) bool {
+	for _, transition := range listingTransitions {
+		if transition.From == status || transition.To == status {
+			return true
+		}
+	}
+	return false
+}
+
+func is_known_action(action ListingAction) bool {
+	for _, transition := range listingTransitions {
+		if transition.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
+// ============================================================================================================================
+// check_listing_action() - can the listing perform action at all from where it is now
+//
+// If to is empty any destination for the action is accepted.
+// ============================================================================================================================
+func check_listing_action(listing ProductListingContract, action ListingAction, to ListingStatus) error {
+	transitionErr := &TransitionError{
+		ListingId: listing.Id,
+		Action:    action,
+		From:      listing.Status,
+		To:        to,
+		Holder:    listing.OwnerType,
+	}
+
+	if !is_known_status(listing.Status) {
+		transitionErr.Reason = ReasonUnknownStatus
+		transitionErr.Message = "Listing " + listing.Id + " has unknown status " + string(listing.Status)
+		return transitionErr
+	}
+	if !is_known_action(action) {
+		transitionErr.Reason = ReasonUnknownAction
+		transitionErr.Message = "Unknown listing action " + string(action)
+		return transitionErr
+	}
+
+	// until its consignment has a verdict a listing only moves with the rest of the consignment, see check_consignment()
+	if len(listing.ConsignmentId) > 0 && listing.Status == StatusExemptCheckReq && action != ActionCheckProducts {
+		transitionErr.Reason = ReasonInConsignment
+		transitionErr.Message = "Listing " + listing.Id + " is waiting for consignment " + listing.ConsignmentId + " to be checked"
+		return transitionErr
+	}
+
+	for _, transition := range listingTransitions {
+		if transition.Action != action || transition.From != listing.Status {
+			continue
+		}
+		if len(to) > 0 && transition.To != to {
+			continue
+		}
+		if !strings.EqualFold(transition.Holder, listing.OwnerType) {
+			transitionErr.Required = transition.Holder
+			continue
+		}
+		return nil
+	}
+
+	if len(transitionErr.Required) > 0 {
+		transitionErr.Reason = ReasonWrongHolder
+		transitionErr.Message = fmt.Sprintf("Listing %s must be held by %s to %s, currently held by %s", listing.Id, transitionErr.Required, action, listing.OwnerType)
+		return transitionErr
+	}
+	transitionErr.Reason = ReasonIllegalTransition
+	if len(to) > 0 {
+		transitionErr.Message = fmt.Sprintf("Listing %s cannot %s from %s to %s", listing.Id, action, listing.Status, to)
+	} else {
+		transitionErr.Message = fmt.Sprintf("Listing %s cannot %s from %s", listing.Id, action, listing.Status)
+	}
+	return transitionErr
+}
+
+// ============================================================================================================================
+// transition_listing() - move the listing to a new status, or refuse with a TransitionError
+// ============================================================================================================================
+func transition_listing(listing *ProductListingContract, action ListingAction, to ListingStatus) error {
+	err := check_listing_action(*listing, action, to)
+	if err != nil {
+		return err
+	}
+	fmt.Println("listing " + listing.Id + " " + string(listing.Status) + " -> " + string(to) + " (" + string(action) + ")")
+	listing.Status = to
+	return nil
+}
+
+// ============================================================================================================================
+// Get Listing Transitions - which actions a listing can take next
+//
+// Inputs - Array of strings
+//
+//	none        - returns the full transition table
+//	listing id  - returns every transition with "allowed" set for this listing
+//
+// Returns:
+//
+//	{
+//		"listingId": "productlistingcontract1",
+//		"status": "EXEMPTCHECKREQ",
+//		"ownertype": "Importer",
+//		"transitions": [{
+//			"action": "check_products",
+//			"from": "EXEMPTCHECKREQ",
+//			"to": "CHECKCOMPLETED",
+//			"holder": "Importer",
+//			"allowed": true
+//		}]
+//	}
+//
+// ============================================================================================================================
+func get_listing_transitions(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	type AvailableTransition struct {
+		ListingTransition
+		Allowed bool   `json:"allowed"`
+		Reason  string `json:"reason,omitempty"`
+	}
+	type ListingTransitions struct {
+		ListingId   string                `json:"listingId,omitempty"`
+		Status      ListingStatus         `json:"status,omitempty"`
+		OwnerType   string                `json:"ownertype,omitempty"`
+		Transitions []AvailableTransition `json:"transitions"`
+	}
+	var result ListingTransitions
+	fmt.Println("starting get_listing_transitions")
+
+	if len(args) > 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 0 or 1, the listing id")
+	}
+
+	if len(args) == 0 {
+		tableAsBytes, _ := json.Marshal(map[string][]ListingTransition{"transitions": listingTransitions})
+		fmt.Println("- end get_listing_transitions")
+		return shim.Success(tableAsBytes)
+	}
+
+	productListing, err := get_product_listing(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result.ListingId = productListing.Id
+	result.Status = productListing.Status
+	result.OwnerType = productListing.OwnerType
+	for _, transition := range listingTransitions {
+		available := AvailableTransition{ListingTransition: transition}
+		err = check_listing_action(productListing, transition.Action, transition.To)
+		if err == nil {
+			available.Allowed = true
+		} else if transitionErr, ok := err.(*TransitionError); ok {
+			available.Reason = transitionErr.Reason
+		}
+		result.Transitions = append(result.Transitions, available)
+	}
+
+	resultAsBytes, _ := json.Marshal(result)
+	fmt.Println("- end get_listing_transitions")
+	return shim.Success(resultAsBytes)
+}
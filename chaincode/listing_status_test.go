@@ -0,0 +1,203 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var listingStatuses = []ListingStatus{
+	StatusInitialRequest, StatusExemptCheckReq, StatusHazardAnalysisCheckReq, StatusHazardAnalysisReview, StatusSignOffReq,
+	StatusCheckCompleted, StatusRejected, StatusSplit, StatusReExported, StatusDestroyed, StatusReleasedAfterCorrection,
+}
+
+var listingActions = []ListingAction{
+	ActionTransferToImporter, ActionTransferToRetailer, ActionCheckProducts, ActionSubmitHazard, ActionApproveHazard,
+	ActionRejectHazard, ActionRejectListing, ActionRecordDisposition, ActionSplitListing, ActionSignOff,
+}
+
+func transition_reason(err error) string {
+	if err == nil {
+		return ""
+	}
+	transitionErr, ok := err.(*TransitionError)
+	if !ok {
+		return "not a TransitionError: " + err.Error()
+	}
+	return transitionErr.Reason
+}
+
+// the moves a listing can make, by status and action
+func TestListingTransitions(t *testing.T) {
+	cases := []struct {
+		from   ListingStatus
+		action ListingAction
+		to     []ListingStatus
+	}{
+		{StatusInitialRequest, ActionTransferToImporter, []ListingStatus{StatusExemptCheckReq}},
+		{StatusExemptCheckReq, ActionCheckProducts, []ListingStatus{StatusCheckCompleted, StatusHazardAnalysisCheckReq, StatusSignOffReq}},
+		{StatusExemptCheckReq, ActionRejectListing, []ListingStatus{StatusRejected}},
+		{StatusHazardAnalysisCheckReq, ActionSubmitHazard, []ListingStatus{StatusHazardAnalysisReview}},
+		{StatusHazardAnalysisCheckReq, ActionRejectListing, []ListingStatus{StatusRejected}},
+		{StatusHazardAnalysisReview, ActionApproveHazard, []ListingStatus{StatusCheckCompleted, StatusSignOffReq}},
+		{StatusHazardAnalysisReview, ActionRejectHazard, []ListingStatus{StatusHazardAnalysisCheckReq}},
+		{StatusHazardAnalysisReview, ActionRejectListing, []ListingStatus{StatusRejected}},
+		{StatusSignOffReq, ActionSignOff, []ListingStatus{StatusSignOffReq, StatusCheckCompleted, StatusRejected}},
+		{StatusSignOffReq, ActionRejectListing, []ListingStatus{StatusRejected}},
+		{StatusCheckCompleted, ActionTransferToRetailer, []ListingStatus{StatusCheckCompleted}},
+		{StatusCheckCompleted, ActionSplitListing, []ListingStatus{StatusCheckCompleted, StatusSplit}},
+		{StatusRejected, ActionRecordDisposition, []ListingStatus{StatusReExported, StatusDestroyed, StatusReleasedAfterCorrection}},
+		{StatusReleasedAfterCorrection, ActionTransferToRetailer, []ListingStatus{StatusReleasedAfterCorrection}},
+		{StatusReleasedAfterCorrection, ActionSplitListing, []ListingStatus{StatusReleasedAfterCorrection, StatusSplit}},
+	}
+
+	moves := 0
+	for _, from := range listingStatuses {
+		for _, action := range listingActions {
+			var allowed []ListingStatus
+			for _, c := range cases {
+				if c.from == from && c.action == action {
+					allowed = c.to
+				}
+			}
+			moves += len(allowed)
+
+			for _, to := range listingStatuses {
+				want := ReasonIllegalTransition
+				for _, status := range allowed {
+					if status == to {
+						want = ""
+					}
+				}
+				holder := "Importer"
+				if from == StatusInitialRequest {
+					holder = "Supplier"
+				}
+				listing := ProductListingContract{Id: "l1", Status: from, OwnerType: holder}
+				if got := transition_reason(check_listing_action(listing, action, to)); got != want {
+					t.Errorf("%s %s -> %s: got %q, want %q", from, action, to, got, want)
+				}
+			}
+
+			// any destination
+			holder := "Importer"
+			if from == StatusInitialRequest {
+				holder = "Supplier"
+			}
+			want := ""
+			if len(allowed) == 0 {
+				want = ReasonIllegalTransition
+			}
+			listing := ProductListingContract{Id: "l1", Status: from, OwnerType: holder}
+			if got := transition_reason(check_listing_action(listing, action, "")); got != want {
+				t.Errorf("%s %s -> any: got %q, want %q", from, action, got, want)
+			}
+		}
+	}
+	if moves != len(listingTransitions) {
+		t.Errorf("the cases cover %d moves, listingTransitions has %d", moves, len(listingTransitions))
+	}
+
+	// nothing leaves a split or disposed of listing
+	for _, status := range []ListingStatus{StatusSplit, StatusReExported, StatusDestroyed} {
+		for _, transition := range listingTransitions {
+			if transition.From == status {
+				t.Errorf("%s should be final, %s leaves it", status, transition.Action)
+			}
+		}
+	}
+}
+
+func TestListingTransitionRefusals(t *testing.T) {
+	cases := []struct {
+		name     string
+		listing  ProductListingContract
+		action   ListingAction
+		to       ListingStatus
+		reason   string
+		required string
+	}{
+		{"importer checks", ProductListingContract{Id: "l1", Status: StatusExemptCheckReq, OwnerType: "Importer"},
+			ActionCheckProducts, StatusCheckCompleted, "", ""},
+		{"holder is matched without case", ProductListingContract{Id: "l1", Status: StatusExemptCheckReq, OwnerType: "importer"},
+			ActionCheckProducts, StatusCheckCompleted, "", ""},
+		{"supplier checks", ProductListingContract{Id: "l1", Status: StatusExemptCheckReq, OwnerType: "Supplier"},
+			ActionCheckProducts, StatusCheckCompleted, ReasonWrongHolder, "Importer"},
+		{"importer transfers to itself", ProductListingContract{Id: "l1", Status: StatusInitialRequest, OwnerType: "Importer"},
+			ActionTransferToImporter, "", ReasonWrongHolder, "Supplier"},
+		{"retailer passes the listing on", ProductListingContract{Id: "l1", Status: StatusCheckCompleted, OwnerType: "Retailer"},
+			ActionTransferToRetailer, StatusCheckCompleted, ReasonWrongHolder, "Importer"},
+		{"wrong holder and wrong move", ProductListingContract{Id: "l1", Status: StatusCheckCompleted, OwnerType: "Retailer"},
+			ActionCheckProducts, "", ReasonIllegalTransition, ""},
+		{"unknown status", ProductListingContract{Id: "l1", Status: "SHIPPED", OwnerType: "Importer"},
+			ActionCheckProducts, "", ReasonUnknownStatus, ""},
+		{"empty status", ProductListingContract{Id: "l1", OwnerType: "Importer"},
+			ActionCheckProducts, "", ReasonUnknownStatus, ""},
+		{"unknown action", ProductListingContract{Id: "l1", Status: StatusExemptCheckReq, OwnerType: "Importer"},
+			"ship", "", ReasonUnknownAction, ""},
+		{"consignment listing checked on its own terms", ProductListingContract{Id: "l1", Status: StatusExemptCheckReq, OwnerType: "Importer", ConsignmentId: "c1"},
+			ActionCheckProducts, StatusHazardAnalysisCheckReq, "", ""},
+		{"consignment listing rejected alone", ProductListingContract{Id: "l1", Status: StatusExemptCheckReq, OwnerType: "Importer", ConsignmentId: "c1"},
+			ActionRejectListing, StatusRejected, ReasonInConsignment, ""},
+		{"consignment listing after the verdict", ProductListingContract{Id: "l1", Status: StatusHazardAnalysisCheckReq, OwnerType: "Importer", ConsignmentId: "c1"},
+			ActionRejectListing, StatusRejected, "", ""},
+	}
+	for _, c := range cases {
+		err := check_listing_action(c.listing, c.action, c.to)
+		if got := transition_reason(err); got != c.reason {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.reason)
+			continue
+		}
+		if err == nil {
+			continue
+		}
+
+		// the error text is the TransitionError as JSON
+		var decoded TransitionError
+		if jsonErr := json.Unmarshal([]byte(err.Error()), &decoded); jsonErr != nil {
+			t.Errorf("%s: error is not JSON - %s", c.name, err.Error())
+			continue
+		}
+		if decoded.Reason != c.reason || decoded.ListingId != c.listing.Id || decoded.Action != c.action || decoded.From != c.listing.Status ||
+			decoded.To != c.to || decoded.Holder != c.listing.OwnerType || decoded.Required != c.required || len(decoded.Message) == 0 {
+			t.Errorf("%s: unexpected error %s", c.name, err.Error())
+		}
+	}
+}
+
+func TestTransitionListing(t *testing.T) {
+	listing := ProductListingContract{Id: "l1", Status: StatusRejected, OwnerType: "Importer"}
+	if err := transition_listing(&listing, ActionRecordDisposition, StatusExemptCheckReq); err == nil {
+		t.Fatal("a rejected listing cannot go back to its exempt check")
+	}
+	if listing.Status != StatusRejected {
+		t.Errorf("a refused transition moved the listing to %s", listing.Status)
+	}
+	if err := transition_listing(&listing, ActionRecordDisposition, StatusDestroyed); err != nil {
+		t.Fatal(err.Error())
+	}
+	if listing.Status != StatusDestroyed {
+		t.Errorf("listing is %s, want %s", listing.Status, StatusDestroyed)
+	}
+	if listingInitialStatus != StatusInitialRequest || !is_known_status(listingInitialStatus) {
+		t.Errorf("listings should start as %s", StatusInitialRequest)
+	}
+}
@@ -0,0 +1,360 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Profiles - legal name, contact details and address of a participant
+//
+// Participants register with init_user / init_regulator and fill in their profile with update_user. The country and
+// organisation a participant is regulated under (countryId, orgId) are not part of the profile: they come from the
+// certificate and registration, decide jurisdiction and exemptions, and cannot be changed with update_user.
+// ============================================================================================================================
+
+// profile fields update_user accepts, and the longest value each may have
+var profileFields = map[string]int{
+	"legalName":  128,
+	"firstName":  64,
+	"middleName": 64,
+	"lastName":   64,
+	"email":      254,
+	"phone":      32,
+	"address":    0, // an object, see addressFields
+}
+
+var addressFields = map[string]int{
+	"street":     128,
+	"city":       64,
+	"region":     64,
+	"postalCode": 16,
+	"countryId":  2,
+}
+
+// participant fields that are set at registration
+var registeredFields = []string{"id", "Id", "Type", "countryId", "orgId", "licenseNumber", "identity", "suspension"}
+
+// ============================================================================================================================
+// get_participant() - a participant as the type it registered as, Supplier, Importer, Retailer, Broker or Regulator
+// ============================================================================================================================
+func get_participant(stub shim.ChaincodeStubInterface, id string) (interface{}, error) {
+	user, err := get_user(stub, id)
+	if err != nil {
+		return nil, err
+	}
+	switch user.Type {
+	case RoleSupplier:
+		return get_supplier(stub, id)
+	case RoleImporter:
+		return get_importer(stub, id)
+	case RoleRetailer:
+		return get_retailer(stub, id)
+	case RoleBroker:
+		return get_broker(stub, id)
+	case RoleRegulator:
+		return get_regulator(stub, id)
+	}
+	return nil, errors.New("Participant does not exist - " + id)
+}
+
+// ============================================================================================================================
+// put_profile() - replace a participant's profile, leaving the rest of its record as it is
+// ============================================================================================================================
+func put_profile(stub shim.ChaincodeStubInterface, id string, profile Profile) error {
+	var participant map[string]json.RawMessage
+	participantAsBytes, err := get_entity_state(stub, participantNamespace, id)
+	if err != nil {
+		return errors.New("Failed to get participant - " + id)
+	}
+	err = json.Unmarshal(participantAsBytes, &participant)
+	if err != nil || participant == nil {
+		return errors.New("Participant does not exist - " + id)
+	}
+	participant["profile"], _ = json.Marshal(profile)
+	participantAsBytes, _ = json.Marshal(participant)
+	return put_entity_state(stub, participantNamespace, id, participantAsBytes)
+}
+
+// ============================================================================================================================
+// parse_profile_update() - apply a JSON object of profile fields to a profile
+//
+// Fields left out keep their value, an empty string clears one. An address replaces the whole address.
+// ============================================================================================================================
+func parse_profile_update(profile Profile, arg string) (Profile, error) {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal([]byte(arg), &fields)
+	if err != nil || fields == nil {
+		return profile, errors.New("Profile must be a JSON object")
+	}
+	var problems []string
+	for field, value := range fields {
+		if contains_string(registeredFields, field) {
+			problems = append(problems, field+": set at registration, cannot be updated")
+			continue
+		}
+		if _, ok := profileFields[field]; !ok {
+			problems = append(problems, field+": not a profile field")
+			continue
+		}
+		if field == "address" {
+			var address map[string]json.RawMessage
+			if json.Unmarshal(value, &address) != nil || address == nil {
+				problems = append(problems, "address: must be an object")
+				continue
+			}
+			for addressField, addressValue := range address {
+				if _, ok := addressFields[addressField]; !ok {
+					problems = append(problems, "address."+addressField+": not an address field")
+				} else if !is_json_string(addressValue) {
+					problems = append(problems, "address."+addressField+": must be a string")
+				}
+			}
+			continue
+		}
+		if !is_json_string(value) {
+			problems = append(problems, field+": must be a string")
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems) // map order differs between peers
+		return profile, profile_error(problems)
+	}
+
+	if _, ok := fields["address"]; ok {
+		profile.Address = Address{}
+	}
+	json.Unmarshal([]byte(arg), &profile)
+	return profile, validate_profile(profile)
+}
+
+func is_json_string(value json.RawMessage) bool {
+	var s string
+	return json.Unmarshal(value, &s) == nil
+}
+
+func profile_error(problems []string) error {
+	return errors.New("Invalid profile - " + strings.Join(problems, "; "))
+}
+
+// ============================================================================================================================
+// validate_profile() - check every field of a profile, reporting each one that is wrong
+// ============================================================================================================================
+func validate_profile(profile Profile) error {
+	problems := profile_problems(profile)
+	if len(problems) > 0 {
+		return profile_error(problems)
+	}
+	return nil
+}
+
+// profile_problems() - what is wrong with each field of a profile, "field: problem"
+func profile_problems(profile Profile) []string {
+	var problems []string
+	check := func(field string, value string, limit int, valid func(string) string) {
+		if len(value) == 0 {
+			return
+		}
+		if len(value) > limit {
+			problems = append(problems, fmt.Sprintf("%s: must be <= %d characters", field, limit))
+			return
+		}
+		if value != strings.TrimSpace(value) {
+			problems = append(problems, field+": must not start or end with spaces")
+			return
+		}
+		for _, r := range value {
+			if unicode.IsControl(r) {
+				problems = append(problems, field+": must not contain control characters")
+				return
+			}
+		}
+		if valid != nil {
+			if problem := valid(value); len(problem) > 0 {
+				problems = append(problems, field+": "+problem)
+			}
+		}
+	}
+
+	check("legalName", profile.LegalName, profileFields["legalName"], nil)
+	check("firstName", profile.FirstName, profileFields["firstName"], valid_person_name)
+	check("middleName", profile.MiddleName, profileFields["middleName"], valid_person_name)
+	check("lastName", profile.LastName, profileFields["lastName"], valid_person_name)
+	check("email", profile.Email, profileFields["email"], valid_email)
+	check("phone", profile.Phone, profileFields["phone"], valid_phone)
+	check("address.street", profile.Address.Street, addressFields["street"], nil)
+	check("address.city", profile.Address.City, addressFields["city"], nil)
+	check("address.region", profile.Address.Region, addressFields["region"], nil)
+	check("address.postalCode", profile.Address.PostalCode, addressFields["postalCode"], valid_postal_code)
+	check("address.countryId", profile.Address.CountryId, addressFields["countryId"], valid_country_code)
+	return problems
+}
+
+// ========================================================
+// Field validators - return what is wrong with a value, "" if nothing
+// ========================================================
+func valid_person_name(value string) string {
+	for _, r := range value {
+		if !unicode.IsLetter(r) && !unicode.IsMark(r) && !strings.ContainsRune(" '-.", r) {
+			return "must contain only letters, spaces, apostrophes, hyphens and full stops"
+		}
+	}
+	return ""
+}
+
+func valid_email(value string) string {
+	at := strings.LastIndex(value, "@")
+	if at < 1 || strings.ContainsAny(value, " \t") {
+		return "must be an email address"
+	}
+	domain := value[at+1:]
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "must be an email address"
+	}
+	return ""
+}
+
+func valid_phone(value string) string {
+	digits := 0
+	for i, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '+' && i == 0:
+		case strings.ContainsRune(" -()", r):
+		default:
+			return "must contain only digits, spaces, hyphens, brackets and a leading +"
+		}
+	}
+	if digits < 7 || digits > 15 {
+		return "must have between 7 and 15 digits"
+	}
+	return ""
+}
+
+func valid_postal_code(value string) string {
+	for _, r := range value {
+		if !(r >= '0' && r <= '9') && !(r >= 'A' && r <= 'Z') && !(r >= 'a' && r <= 'z') && r != ' ' && r != '-' {
+			return "must contain only letters, digits, spaces and hyphens"
+		}
+	}
+	return ""
+}
+
+// an ISO 3166-1 alpha-2 code, see countryCodes in fields.go
+func valid_country_code(value string) string {
+	if !contains_string(countryCodes, value) {
+		return "must be an ISO 3166 country code, eg US"
+	}
+	return ""
+}
+
+// ============================================================================================================================
+// Update User - participant updates its own profile
+//
+// Inputs - Array of strings
+//
+//	      0       ,                                      1
+//	participant id,                            profile fields (JSON)
+//	 "supplier1"  , {"legalName": "Acme Foods Inc.", "email": "imports@acme.example", "address": {"city": "Austin"}}
+//
+// Fields: legalName, firstName, middleName, lastName (contact person), email, phone and address (street, city, region,
+// postalCode, countryId). Fields left out keep their value, an empty string clears one, an address replaces the
+// whole address. Every invalid field is reported.
+//
+// Returns - the participant, as the type it registered as
+// ============================================================================================================================
+func update_user(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting update_user")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting participant id and profile fields")
+	}
+
+	id := args[0]
+
+	user, err := get_user(stub, id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if _, ok := userResources[user.Type]; !ok && user.Type != RoleRegulator {
+		return shim.Error("Participant does not exist - " + id)
+	}
+	err = assert_caller(stub, id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	profile, err := parse_profile_update(user.Profile, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = put_profile(stub, id, profile)
+	if err != nil {
+		fmt.Println("Could not store participant")
+		return shim.Error(err.Error())
+	}
+
+	participant, err := get_participant(stub, id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	participantAsBytes, _ := json.Marshal(participant)
+	fmt.Println("- end update_user")
+	return shim.Success(participantAsBytes)
+}
+
+// ============================================================================================================================
+// Get User - read a participant as the type it registered as
+//
+// Inputs - Array of strings
+//
+//	      0
+//	participant id
+//	 "importer1"
+//
+// Returns - Supplier, Importer, Retailer, Broker or Regulator
+// ============================================================================================================================
+func read_user(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting get_user")
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting participant id")
+	}
+
+	participant, err := get_participant(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	participantAsBytes, _ := json.Marshal(participant)
+	fmt.Println("- end get_user")
+	return shim.Success(participantAsBytes)
+}
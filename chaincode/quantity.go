@@ -0,0 +1,260 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// ============================================================================================================================
+// Quantities - exact decimal amounts with a unit of measure
+//
+// Amounts are kept on the ledger as decimal strings ("12.5") and only ever handled as big.Rat in between, so adding,
+// splitting and converting never loses precision to floating point.
+// ============================================================================================================================
+
+const maxQuantityDecimals = 6
+
+// no single amount can be larger, totals can
+const maxQuantity = 1000000000
+
+// records written before units existed are counts
+const defaultUnit = "units"
+
+type UnitOfMeasure struct {
+	Name      string
+	Dimension string   // only units of the same dimension can be converted or summed together
+	ToBase    *big.Rat // multiply by this to get the dimension's base unit
+	Whole     bool     // counts cannot be fractional
+}
+
+var unitsOfMeasure = map[string]UnitOfMeasure{
+	"kg":     {"kg", "mass", big.NewRat(1, 1), false},
+	"lb":     {"lb", "mass", big.NewRat(45359237, 100000000), false}, // international pound
+	"litres": {"litres", "volume", big.NewRat(1, 1), false},
+	"units":  {"units", "count", big.NewRat(1, 1), true},
+	"cases":  {"cases", "cases", big.NewRat(1, 1), true}, // case sizes vary, so cases never convert to units
+}
+
+var baseUnits = map[string]string{
+	"mass":   "kg",
+	"volume": "litres",
+	"count":  "units",
+	"cases":  "cases",
+}
+
+var decimalPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+type QuantityTotal struct {
+	Amount string `json:"amount"`
+	Unit   string `json:"unit"`
+}
+
+func get_unit(unit string) (UnitOfMeasure, error) {
+	uom, ok := unitsOfMeasure[strings.ToLower(unit)]
+	if !ok {
+		return uom, errors.New("Unknown unit of measure " + unit + ". Expecting kg, lb, litres, units or cases")
+	}
+	return uom, nil
+}
+
+// ============================================================================================================================
+// parse_quantity() - validate a decimal amount for a unit, amounts must be positive
+// ============================================================================================================================
+func parse_quantity(amount string, unit string) (*big.Rat, error) {
+	uom, err := get_unit(unit)
+	if err != nil {
+		return nil, err
+	}
+	quantity, err := parse_amount(amount)
+	if err != nil {
+		return nil, err
+	}
+	if uom.Whole && !quantity.IsInt() {
+		return nil, errors.New("Quantity in " + uom.Name + " must be a whole number")
+	}
+	return quantity, nil
+}
+
+// parse_amount() - a quantity before its unit is known, greater than zero and at most maxQuantity
+func parse_amount(amount string) (*big.Rat, error) {
+	if !decimalPattern.MatchString(amount) {
+		return nil, errors.New("Quantity " + amount + " must be a decimal number such as 12 or 12.5")
+	}
+	if dot := strings.Index(amount, "."); dot >= 0 && len(amount)-dot-1 > maxQuantityDecimals {
+		return nil, errors.New("Quantity " + amount + " has more than 6 decimal places")
+	}
+
+	quantity, ok := new(big.Rat).SetString(amount)
+	if !ok {
+		return nil, errors.New("Quantity " + amount + " is not a valid number")
+	}
+	if quantity.Sign() <= 0 {
+		return nil, errors.New("Quantity must be greater than zero")
+	}
+	if quantity.Cmp(big.NewRat(maxQuantity, 1)) > 0 {
+		return nil, errors.New("Quantity " + amount + " is more than " + strconv.Itoa(maxQuantity))
+	}
+	return quantity, nil
+}
+
+// valid_quantity() - field validator for quantities, see fields.go
+func valid_quantity(value string) string {
+	if _, err := parse_amount(value); err != nil {
+		return fmt.Sprintf("must be a decimal number greater than 0 and at most %d, with up to %d decimal places", maxQuantity, maxQuantityDecimals)
+	}
+	return ""
+}
+
+// ============================================================================================================================
+// convert_quantity() - convert an amount between units of the same dimension
+// ============================================================================================================================
+func convert_quantity(quantity *big.Rat, from string, to string) (*big.Rat, error) {
+	fromUnit, err := get_unit(from)
+	if err != nil {
+		return nil, err
+	}
+	toUnit, err := get_unit(to)
+	if err != nil {
+		return nil, err
+	}
+	if fromUnit.Dimension != toUnit.Dimension {
+		return nil, errors.New("Cannot convert " + fromUnit.Name + " to " + toUnit.Name)
+	}
+
+	converted := new(big.Rat).Mul(quantity, fromUnit.ToBase)
+	return converted.Quo(converted, toUnit.ToBase), nil
+}
+
+// ============================================================================================================================
+// format_decimal() - exact decimal string when the amount has one, otherwise rounded to 6 places
+// ============================================================================================================================
+func format_decimal(quantity *big.Rat) string {
+	places := maxQuantityDecimals
+	denom := new(big.Int).Set(quantity.Denom())
+	twos, fives := 0, 0
+	two, five, zero := big.NewInt(2), big.NewInt(5), big.NewInt(0)
+	mod := new(big.Int)
+	for mod.Mod(denom, two).Cmp(zero) == 0 {
+		denom.Quo(denom, two)
+		twos++
+	}
+	for mod.Mod(denom, five).Cmp(zero) == 0 {
+		denom.Quo(denom, five)
+		fives++
+	}
+	if denom.Cmp(big.NewInt(1)) == 0 {
+		places = twos
+		if fives > places {
+			places = fives
+		}
+	}
+
+	formatted := quantity.FloatString(places)
+	if strings.Contains(formatted, ".") {
+		formatted = strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
+	}
+	return formatted
+}
+
+// ============================================================================================================================
+// Quantity totals - add up amounts per dimension
+//
+// Each dimension is totalled in its base unit (kg, litres, units, cases) unless a display unit of that dimension is
+// given, e.g. "lb" reports the mass total in pounds.
+// ============================================================================================================================
+type quantityTotals map[string]*big.Rat
+
+func (totals quantityTotals) add(amount string, unit string) error {
+	quantity, err := parse_quantity(amount, unit)
+	if err != nil {
+		return err
+	}
+	uom, _ := get_unit(unit)
+	base, err := convert_quantity(quantity, uom.Name, baseUnits[uom.Dimension])
+	if err != nil {
+		return err
+	}
+	if _, ok := totals[uom.Dimension]; !ok {
+		totals[uom.Dimension] = new(big.Rat)
+	}
+	totals[uom.Dimension].Add(totals[uom.Dimension], base)
+	return nil
+}
+
+func (totals quantityTotals) list(displayUnit string) ([]QuantityTotal, error) {
+	var display UnitOfMeasure
+	if len(displayUnit) > 0 {
+		var err error
+		display, err = get_unit(displayUnit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	list := []QuantityTotal{}
+	for dimension, total := range totals {
+		unit := baseUnits[dimension]
+		amount := total
+		if display.Dimension == dimension {
+			amount, _ = convert_quantity(total, unit, display.Name)
+			unit = display.Name
+		}
+		list = append(list, QuantityTotal{Amount: format_decimal(amount), Unit: unit})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Unit < list[j].Unit })
+	return list, nil
+}
+
+// unit of a product, falling back for products stored before units existed
+func product_unit(product Product) string {
+	if len(product.Unit) == 0 {
+		return defaultUnit
+	}
+	return product.Unit
+}
+
+// ============================================================================================================================
+// listing_product_quantity() - how much of a product a listing carries, all of it unless the listing was split
+// ============================================================================================================================
+func listing_product_quantity(stub shim.ChaincodeStubInterface, listing ProductListingContract, productId string) (*big.Rat, string, error) {
+	product, err := get_product(stub, productId)
+	if err != nil {
+		return nil, "", err
+	}
+	unit := product_unit(product)
+	amount := product.Quantity
+	if allocated, ok := listing.Allocations[productId]; ok {
+		amount = allocated
+	}
+	quantity, err := parse_quantity(amount, unit)
+	if err != nil {
+		return nil, "", errors.New("Product " + productId + " - " + err.Error())
+	}
+	return quantity, unit, nil
+}
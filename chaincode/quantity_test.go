@@ -0,0 +1,199 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseQuantity(t *testing.T) {
+	cases := []struct {
+		amount string
+		unit   string
+		want   string // exact value as a fraction, empty when the quantity is refused
+	}{
+		{"12", "units", "12/1"},
+		{"12.5", "kg", "25/2"},
+		{"0.000001", "kg", "1/1000000"},
+		{"1000000000", "litres", "1000000000/1"},
+		{"12", "KG", "12/1"},
+		{"12.5", "units", ""},
+		{"1.5", "cases", ""},
+		{"0", "kg", ""},
+		{"0.0", "kg", ""},
+		{"-1", "kg", ""},
+		{"1000000000.5", "kg", ""},
+		{"0.0000001", "kg", ""},
+		{"1e3", "kg", ""},
+		{".5", "kg", ""},
+		{"5.", "kg", ""},
+		{" 5", "kg", ""},
+		{"", "kg", ""},
+		{"5", "tonnes", ""},
+		{"5", "", ""},
+	}
+	for _, c := range cases {
+		quantity, err := parse_quantity(c.amount, c.unit)
+		if len(c.want) == 0 {
+			if err == nil {
+				t.Errorf("parse_quantity(%q, %q) = %s, want an error", c.amount, c.unit, quantity.String())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parse_quantity(%q, %q): %s", c.amount, c.unit, err.Error())
+			continue
+		}
+		if quantity.String() != c.want {
+			t.Errorf("parse_quantity(%q, %q) = %s, want %s", c.amount, c.unit, quantity.String(), c.want)
+		}
+	}
+}
+
+func TestValidQuantity(t *testing.T) {
+	for _, value := range []string{"1", "12.5", "0.000001", "1000000000"} {
+		if problem := valid_quantity(value); len(problem) > 0 {
+			t.Errorf("valid_quantity(%q) = %q, want no problem", value, problem)
+		}
+	}
+	// fractional counts are only refused once the unit is known
+	if problem := valid_quantity("2.5"); len(problem) > 0 {
+		t.Errorf("valid_quantity(\"2.5\") = %q, want no problem", problem)
+	}
+	for _, value := range []string{"0", "-2", "abc", "1.1234567", "1000000001"} {
+		if problem := valid_quantity(value); len(problem) == 0 {
+			t.Errorf("valid_quantity(%q) should report a problem", value)
+		}
+	}
+}
+
+func TestConvertQuantity(t *testing.T) {
+	cases := []struct {
+		amount string
+		from   string
+		to     string
+		want   string // formatted result, empty when the units cannot be converted
+	}{
+		{"1", "lb", "kg", "0.45359237"},
+		{"2", "lb", "kg", "0.90718474"},
+		{"0.45359237", "kg", "lb", "1"},
+		{"1", "kg", "lb", "2.204623"},
+		{"3", "kg", "kg", "3"},
+		{"3", "LB", "Kg", "1.36077711"},
+		{"7", "units", "units", "7"},
+		{"1", "kg", "litres", ""},
+		{"1", "cases", "units", ""},
+		{"1", "units", "cases", ""},
+		{"1", "kg", "stone", ""},
+		{"1", "stone", "kg", ""},
+	}
+	for _, c := range cases {
+		quantity, _ := new(big.Rat).SetString(c.amount)
+		converted, err := convert_quantity(quantity, c.from, c.to)
+		if len(c.want) == 0 {
+			if err == nil {
+				t.Errorf("convert_quantity(%s, %s, %s) = %s, want an error", c.amount, c.from, c.to, format_decimal(converted))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("convert_quantity(%s, %s, %s): %s", c.amount, c.from, c.to, err.Error())
+			continue
+		}
+		if got := format_decimal(converted); got != c.want {
+			t.Errorf("convert_quantity(%s, %s, %s) = %s, want %s", c.amount, c.from, c.to, got, c.want)
+		}
+	}
+
+	// a round trip is exact, only formatting rounds
+	quantity := big.NewRat(3, 1)
+	pounds, _ := convert_quantity(quantity, "kg", "lb")
+	back, _ := convert_quantity(pounds, "lb", "kg")
+	if back.Cmp(quantity) != 0 {
+		t.Errorf("kg to lb and back gave %s, want 3", back.String())
+	}
+}
+
+func TestFormatDecimal(t *testing.T) {
+	cases := []struct {
+		quantity *big.Rat
+		want     string
+	}{
+		{big.NewRat(0, 1), "0"},
+		{big.NewRat(12, 1), "12"},
+		{big.NewRat(1000000000, 1), "1000000000"},
+		{big.NewRat(25, 2), "12.5"},
+		{big.NewRat(1, 8), "0.125"},
+		{big.NewRat(1, 1000000), "0.000001"},
+		{big.NewRat(45359237, 100000000), "0.45359237"}, // exact, even past 6 places
+		{big.NewRat(1, 3), "0.333333"},
+		{big.NewRat(2, 3), "0.666667"},
+		{big.NewRat(10, 3), "3.333333"},
+		{big.NewRat(1, 3000000), "0"},
+		{big.NewRat(3, 2000000), "0.0000015"},
+	}
+	for _, c := range cases {
+		if got := format_decimal(c.quantity); got != c.want {
+			t.Errorf("format_decimal(%s) = %s, want %s", c.quantity.String(), got, c.want)
+		}
+	}
+}
+
+func TestQuantityTotals(t *testing.T) {
+	totals := quantityTotals{}
+	for _, amount := range [][2]string{{"1", "kg"}, {"1", "lb"}, {"2", "units"}, {"3", "units"}, {"1.5", "litres"}, {"4", "cases"}} {
+		if err := totals.add(amount[0], amount[1]); err != nil {
+			t.Fatalf("add(%s %s): %s", amount[0], amount[1], err.Error())
+		}
+	}
+	if err := totals.add("1.5", "units"); err == nil {
+		t.Error("adding a fractional count should fail")
+	}
+
+	cases := []struct {
+		display string
+		want    []QuantityTotal
+	}{
+		{"", []QuantityTotal{{"4", "cases"}, {"1.45359237", "kg"}, {"1.5", "litres"}, {"5", "units"}}},
+		{"lb", []QuantityTotal{{"4", "cases"}, {"3.204623", "lb"}, {"1.5", "litres"}, {"5", "units"}}},
+		{"units", []QuantityTotal{{"4", "cases"}, {"1.45359237", "kg"}, {"1.5", "litres"}, {"5", "units"}}},
+	}
+	for _, c := range cases {
+		list, err := totals.list(c.display)
+		if err != nil {
+			t.Errorf("list(%q): %s", c.display, err.Error())
+			continue
+		}
+		if len(list) != len(c.want) {
+			t.Errorf("list(%q) = %v, want %v", c.display, list, c.want)
+			continue
+		}
+		for i := range list {
+			if list[i] != c.want[i] {
+				t.Errorf("list(%q) = %v, want %v", c.display, list, c.want)
+				break
+			}
+		}
+	}
+	if _, err := totals.list("stone"); err == nil {
+		t.Error("an unknown display unit should fail")
+	}
+}
@@ -0,0 +1,253 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Query - CouchDB rich queries over one type of entity
+//
+// Callers pass a selector, which is checked before it reaches CouchDB: it must name a docType and may only match the
+// fields listed for it below, with plain values or the comparison operators. The indexes in
+// META-INF/statedb/couchdb/indexes cover docType with status, owner, supplier, destinationCountry and countryId, the
+// fields queried most; peers create them when the chaincode is instantiated.
+//
+// Rich queries need CouchDB as the state database and are not re-run when the transaction is validated, so query() is
+// for reading only.
+// ============================================================================================================================
+
+const (
+	queryDefaultPageSize = 25
+	queryMaxPageSize     = 100
+	queryMaxInValues     = 25
+)
+
+// fields a selector may match for each docType
+var queryFields = map[string][]string{
+	productNamespace:      {"id", "countryId", "unit", "category", "lotNumber", "productionDate", "bestBefore", "gtin"},
+	listingNamespace:      {"id", "status", "owner", "ownertype", "supplier", "destinationCountry", "consignmentId", "parentId"},
+	participantNamespace:  {"Type", "countryId", "orgId"},
+	hazardReportNamespace: {"id", "listingId", "importerId", "status"},
+	consignmentNamespace:  {"id", "importerId", "status"},
+}
+
+var queryOperators = []string{"$eq", "$ne", "$gt", "$gte", "$lt", "$lte", "$in"}
+
+// ============================================================================================================================
+// parse_selector() - check a caller's selector and return the docType it queries
+//
+// Every problem is reported, field by field.
+// ============================================================================================================================
+func parse_selector(arg string) (map[string]interface{}, string, error) {
+	var selector map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(arg))
+	decoder.UseNumber()
+	err := decoder.Decode(&selector)
+	if err != nil || selector == nil {
+		return nil, "", errors.New("Selector must be a JSON object")
+	}
+
+	docType, _ := selector["docType"].(string)
+	fields, ok := queryFields[docType]
+	if !ok {
+		return nil, "", errors.New("Selector must have a docType, one of " + strings.Join(entityNamespaces, ", "))
+	}
+
+	var names []string
+	for name := range selector {
+		names = append(names, name)
+	}
+	sort.Strings(names) // map order differs between peers
+
+	var problems []string
+	for _, name := range names {
+		if name == "docType" {
+			continue
+		}
+		if strings.HasPrefix(name, "$") {
+			problems = append(problems, name+": operators are only allowed on a field")
+			continue
+		}
+		if !contains_string(fields, name) {
+			problems = append(problems, name+": cannot be queried on a "+docType)
+			continue
+		}
+		if problem := check_condition(selector[name]); len(problem) > 0 {
+			problems = append(problems, name+": "+problem)
+		}
+	}
+	if len(problems) > 0 {
+		return nil, "", errors.New("Invalid selector - " + strings.Join(problems, "; "))
+	}
+	return selector, docType, nil
+}
+
+// check_condition() - what is wrong with a field's condition, "" if nothing
+func check_condition(condition interface{}) string {
+	operators, ok := condition.(map[string]interface{})
+	if !ok {
+		if !is_query_scalar(condition) {
+			return "must be a string, number, boolean or an object of operators"
+		}
+		return ""
+	}
+	if len(operators) == 0 {
+		return "needs at least one operator"
+	}
+	var names []string
+	for name := range operators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !contains_string(queryOperators, name) {
+			return "operator " + name + " is not allowed, use one of " + strings.Join(queryOperators, ", ")
+		}
+		if name != "$in" {
+			if !is_query_scalar(operators[name]) {
+				return name + " needs a string, number or boolean"
+			}
+			continue
+		}
+		values, ok := operators[name].([]interface{})
+		if !ok || len(values) == 0 || len(values) > queryMaxInValues {
+			return fmt.Sprintf("$in needs a list of 1 to %d values", queryMaxInValues)
+		}
+		for _, value := range values {
+			if !is_query_scalar(value) {
+				return "$in values must be strings, numbers or booleans"
+			}
+		}
+	}
+	return ""
+}
+
+func is_query_scalar(value interface{}) bool {
+	switch value.(type) {
+	case string, json.Number, bool:
+		return true
+	}
+	return false
+}
+
+// ============================================================================================================================
+// Query - find entities of one type matching a selector, a page at a time
+//
+// Inputs - Array of strings
+//
+//	                                 0                                    ,     1      ,     2
+//	                             selector                                 , page size  , bookmark
+//	{"docType": "listing", "status": "EXEMPTCHECKREQ", "destinationCountry": {"$in": ["US", "CA"]}} ,    "25"    ,    ""
+//
+// The page size defaults to 25, at most 100. Pass the bookmark a page returned to get the next one. Only the records
+// the caller can read are returned, so a page may hold fewer records than were fetched.
+//
+// Returns:
+//
+//	{
+//		"records": [{"docType": "listing", "id": "productlistingcontract1", ...}],
+//		"fetched": 25,
+//		"bookmark": "g1AAAA..."
+//	}
+//
+// ============================================================================================================================
+func query(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	type QueryPage struct {
+		Records  []json.RawMessage `json:"records"`
+		Fetched  int32             `json:"fetched"`
+		Bookmark string            `json:"bookmark"`
+	}
+	fmt.Println("starting query")
+
+	if len(args) < 1 || len(args) > 3 {
+		return shim.Error("Incorrect number of arguments. Expecting selector and an optional page size and bookmark")
+	}
+
+	selector, docType, err := parse_selector(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	pageSize := queryDefaultPageSize
+	if len(args) > 1 && len(args[1]) > 0 {
+		pageSize, err = strconv.Atoi(args[1])
+		if err != nil || pageSize < 1 || pageSize > queryMaxPageSize {
+			return shim.Error(fmt.Sprintf("Page size must be a whole number from 1 to %d", queryMaxPageSize))
+		}
+	}
+	bookmark := ""
+	if len(args) > 2 {
+		bookmark = args[2]
+	}
+
+	// only what the caller can read, see acl.go
+	can_read, err := new_read_filter(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	queryAsBytes, _ := json.Marshal(map[string]interface{}{"selector": selector})
+	queryString := string(queryAsBytes)
+	fmt.Println("- query " + queryString)
+
+	resultsIterator, metadata, err := stub.GetQueryResultWithPagination(queryString, int32(pageSize), bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	page := QueryPage{Records: []json.RawMessage{}}
+	for resultsIterator.HasNext() {
+		aKeyValue, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, keyParts, err := stub.SplitCompositeKey(aKeyValue.Key)
+		if err != nil || len(keyParts) == 0 {
+			continue
+		}
+		var record map[string]json.RawMessage
+		if json.Unmarshal(aKeyValue.Value, &record) != nil {
+			continue
+		}
+		request := describe_entity(AclRequest{Operation: AclRead, ResourceId: keyParts[0]}, docType, record)
+		if !can_read(request) {
+			continue
+		}
+		page.Records = append(page.Records, aKeyValue.Value)
+	}
+	if metadata != nil {
+		page.Fetched = metadata.FetchedRecordsCount
+		page.Bookmark = metadata.Bookmark
+	}
+
+	pageAsBytes, _ := json.Marshal(page)
+	fmt.Println("- end query")
+	return shim.Success(pageAsBytes)
+}
@@ -23,41 +23,49 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-  // "reflect"
+	"strings"
+	// "reflect"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
 )
 
 // ============================================================================================================================
-// Read - read a generic variable from ledger
+// Read - read an entity, or a generic variable, from ledger
 //
 // Shows Off GetState() - reading a key/value from the ledger
 //
 // Inputs - Array of strings
-//  0
-//  key
-//  "abc"
+//
+//	    0    ,     1
+//	  type   ,     id        - product, listing, participant, hazardreport or consignment, see keys.go
+//	"listing", "productlistingcontract1"
+//
+//	or a plain key
+//	   "abc"
 //
 // Returns - string
 // ============================================================================================================================
 func read(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var key, jsonResp string
 	var err error
+	var valAsbytes []byte
 	fmt.Println("starting read")
 
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting key of the var to query")
-	}
-
-	// input sanitation
-	err = sanitize_arguments(args)
-	if err != nil {
-		return shim.Error(err.Error())
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting type and id, or key of the var to query")
 	}
 
 	key = args[0]
-	valAsbytes, err := stub.GetState(key)           //get the var from ledger
+	if len(args) == 2 {
+		if !contains_string(entityNamespaces, args[0]) {
+			return shim.Error("Unknown type " + args[0] + ". Expecting one of " + strings.Join(entityNamespaces, ", "))
+		}
+		key = args[0] + " " + args[1]
+		valAsbytes, err = get_entity_state(stub, args[0], args[1])
+	} else {
+		valAsbytes, err = stub.GetState(key) //get the var from ledger
+	}
 	if err != nil {
 		jsonResp = "{\"Error\":\"Failed to get state for " + key + "\"}"
 		return shim.Error(jsonResp)
@@ -68,49 +76,55 @@ func read(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	fmt.Println(string(valAsbytes))
 	// fmt.Printf("%+v\n", security.Investor)
 
-
 	fmt.Println("- end read")
-	return shim.Success(valAsbytes)                  //send it onward
+	return shim.Success(valAsbytes) //send it onward
 }
 
 // ============================================================================================================================
 // Get everything we need (owners + marbles + companies)
 //
 // Inputs - none
-//
 // Returns:
-// {
-//	"owners": [{
-//			"id": "o99999999",
-//			"company": "United Marbles"
-//			"username": "alice"
-//	}],
-//	"marbles": [{
-//		"id": "m1490898165086",
-//		"color": "white",
-//		"docType" :"marble",
-//		"owner": {
-//			"company": "United Marbles"
-//			"username": "alice"
-//		},
-//		"size" : 35
-//	}]
-// }
+//
+//	{
+//		"owners": [{
+//				"id": "o99999999",
+//				"company": "United Marbles"
+//				"username": "alice"
+//		}],
+//		"marbles": [{
+//			"id": "m1490898165086",
+//			"color": "white",
+//			"docType" :"marble",
+//			"owner": {
+//				"company": "United Marbles"
+//				"username": "alice"
+//			},
+//			"size" : 35
+//		}]
+//	}
+//
 // ============================================================================================================================
 func read_everything(stub shim.ChaincodeStubInterface) pb.Response {
 	type Everything struct {
 		// Users   []User   `json:"users"`
-		Products  			[]Product     `json:"products"`
-		Retailers				  []Retailer				 `json:"retailers"`
-		Importers		[]Importer		 `json:"importers"`
-		Suppliers     []Supplier		 `json:"suppliers"`
-		Regulators     []Regulator		 `json:"regulators"`
+		Products                []Product                `json:"products"`
+		Retailers               []Retailer               `json:"retailers"`
+		Importers               []Importer               `json:"importers"`
+		Suppliers               []Supplier               `json:"suppliers"`
+		Regulators              []Regulator              `json:"regulators"`
 		ProductListingContracts []ProductListingContract `json:listingcontracts`
 	}
 	var everything Everything
 
+	// only what the caller can read, see acl.go
+	can_read, err := new_read_filter(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// ---- Get All Marbles ---- //
-	productsIterator, err := stub.GetStateByRange("product0", "product9999999999999999999")
+	productsIterator, err := stub.GetStateByPartialCompositeKey(productNamespace, []string{})
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -123,100 +137,188 @@ func read_everything(stub shim.ChaincodeStubInterface) pb.Response {
 		}
 		queryValAsBytes := aKeyValue.Value
 		var product Product
-		json.Unmarshal(queryValAsBytes, &product)                  //un stringify it aka JSON.parse()
-		everything.Products = append(everything.Products, product)   //add this marble to the list
+		json.Unmarshal(queryValAsBytes, &product) //un stringify it aka JSON.parse()
+		if !can_read(AclRequest{Resource: "Product", ResourceId: product.Id}) {
+			continue
+		}
+		everything.Products = append(everything.Products, product) //add this marble to the list
 	}
 
-	retailersIterator, err := stub.GetStateByRange("retailer0", "retailer9999999999999999999")
+	// participants share a namespace, sorted by their Type
+	participantsIterator, err := stub.GetStateByPartialCompositeKey(participantNamespace, []string{})
 	if err != nil {
-	  return shim.Error(err.Error())
+		return shim.Error(err.Error())
 	}
-	defer retailersIterator.Close()
-
-	for retailersIterator.HasNext() {
-	  aKeyValue, err := retailersIterator.Next()
-	  if err != nil {
-	    return shim.Error(err.Error())
-	  }
-	  queryValAsBytes := aKeyValue.Value
-	  var retailer Retailer
-	  json.Unmarshal(queryValAsBytes, &retailer)                  //un stringify it aka JSON.parse()
-	  everything.Retailers = append(everything.Retailers, retailer)   //add this marble to the list
+	defer participantsIterator.Close()
+
+	for participantsIterator.HasNext() {
+		aKeyValue, err := participantsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		queryValAsBytes := aKeyValue.Value
+		var user User
+		json.Unmarshal(queryValAsBytes, &user) //un stringify it aka JSON.parse()
+		switch user.Type {
+		case RoleRetailer:
+			var retailer Retailer
+			json.Unmarshal(queryValAsBytes, &retailer)
+			if can_read(AclRequest{Resource: "Retailer", ResourceId: retailer.User.Id, Owner: retailer.User.Id}) {
+				everything.Retailers = append(everything.Retailers, retailer)
+			}
+		case RoleImporter:
+			var importer Importer
+			json.Unmarshal(queryValAsBytes, &importer)
+			if can_read(AclRequest{Resource: "Importer", ResourceId: importer.User.Id, Owner: importer.User.Id}) {
+				everything.Importers = append(everything.Importers, importer)
+			}
+		case RoleSupplier:
+			var supplier Supplier
+			json.Unmarshal(queryValAsBytes, &supplier)
+			if can_read(AclRequest{Resource: "Supplier", ResourceId: supplier.User.Id, Owner: supplier.User.Id}) {
+				everything.Suppliers = append(everything.Suppliers, supplier)
+			}
+		case RoleBroker:
+			// brokers are not listed, read them with get_user
+		default:
+			var regulator Regulator
+			json.Unmarshal(queryValAsBytes, &regulator)
+			if can_read(AclRequest{Resource: "Regulator", ResourceId: regulator.Id, Owner: regulator.Id}) {
+				everything.Regulators = append(everything.Regulators, regulator)
+			}
+		}
 	}
 
-	importersIterator, err := stub.GetStateByRange("importer0", "importer9999999999999999999")
+	productlistingcontractsIterator, err := stub.GetStateByPartialCompositeKey(listingNamespace, []string{})
 	if err != nil {
-	  return shim.Error(err.Error())
-	}
-	defer importersIterator.Close()
-
-	for importersIterator.HasNext() {
-	  aKeyValue, err := importersIterator.Next()
-	  if err != nil {
-	    return shim.Error(err.Error())
-	  }
-	  queryValAsBytes := aKeyValue.Value
-	  var importer Importer
-	  json.Unmarshal(queryValAsBytes, &importer)                  //un stringify it aka JSON.parse()
-	  everything.Importers = append(everything.Importers, importer)   //add this marble to the list
+		return shim.Error(err.Error())
 	}
+	defer productlistingcontractsIterator.Close()
 
-	suppliersIterator, err := stub.GetStateByRange("supplier0", "supplier9999999999999999999")
-	if err != nil {
-	  return shim.Error(err.Error())
+	for productlistingcontractsIterator.HasNext() {
+		aKeyValue, err := productlistingcontractsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		queryValAsBytes := aKeyValue.Value
+		var productlistingcontract ProductListingContract
+		json.Unmarshal(queryValAsBytes, &productlistingcontract) //un stringify it aka JSON.parse()
+		if !can_read(AclRequest{Resource: "ProductListingContract", ResourceId: productlistingcontract.Id,
+			Owner: productlistingcontract.Owner, Supplier: productlistingcontract.Supplier}) {
+			continue
+		}
+		everything.ProductListingContracts = append(everything.ProductListingContracts, productlistingcontract) //add this marble to the list
 	}
-	defer suppliersIterator.Close()
-
-	for suppliersIterator.HasNext() {
-	  aKeyValue, err := suppliersIterator.Next()
-	  if err != nil {
-	    return shim.Error(err.Error())
-	  }
-	  queryValAsBytes := aKeyValue.Value
-	  var supplier Supplier
-	  json.Unmarshal(queryValAsBytes, &supplier)                  //un stringify it aka JSON.parse()
-	  everything.Suppliers = append(everything.Suppliers, supplier)   //add this marble to the list
+
+	fmt.Println("result", everything)
+
+	//change to array of bytes
+	everythingAsBytes, _ := json.Marshal(everything) //convert to array of bytes
+	return shim.Success(everythingAsBytes)
+}
+
+// ============================================================================================================================
+// Get Listing Totals - total quantity of the products in a listing
+//
+// Inputs - Array of strings
+//
+//	     0            ,         1
+//	listing id        , display unit (optional)
+//
+// "productlistingcontract1",        "lb"
+//
+// Returns:
+//
+//	{
+//		"id": "productlistingcontract1",
+//		"totals": [{"amount": "136.077711", "unit": "kg"}, {"amount": "40", "unit": "units"}]
+//	}
+//
+// ============================================================================================================================
+func get_listing_totals(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting get_listing_totals")
+
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting listing id and an optional display unit")
 	}
 
-	regulatorsIterator, err := stub.GetStateByRange("regulator0", "regulator9999999999999999999")
+	productListing, err := get_product_listing(stub, args[0])
 	if err != nil {
-	  return shim.Error(err.Error())
+		return shim.Error(err.Error())
+	}
+
+	totals := quantityTotals{}
+	for _, productId := range productListing.Products {
+		quantity, unit, err := listing_product_quantity(stub, productListing, productId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = totals.add(format_decimal(quantity), unit)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
 	}
-	defer regulatorsIterator.Close()
-
-	for regulatorsIterator.HasNext() {
-	  aKeyValue, err := regulatorsIterator.Next()
-	  if err != nil {
-	    return shim.Error(err.Error())
-	  }
-	  queryValAsBytes := aKeyValue.Value
-	  var regulator Regulator
-	  json.Unmarshal(queryValAsBytes, &regulator)                  //un stringify it aka JSON.parse()
-	  everything.Regulators = append(everything.Regulators, regulator)   //add this marble to the list
+	return quantity_totals_response(productListing.Id, totals, args[1:])
+}
+
+// ============================================================================================================================
+// Get Retailer Totals - total quantity of the products a retailer holds
+//
+// Inputs - Array of strings
+//
+//	     0      ,         1
+//	retailer id , display unit (optional)
+//	"retailer1" ,        "lb"
+//
+// Returns - same as get_listing_totals
+// ============================================================================================================================
+func get_retailer_totals(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting get_retailer_totals")
+
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting retailer id and an optional display unit")
 	}
 
-	productlistingcontractsIterator, err := stub.GetStateByRange("productlistingcontract0", "productlistingcontract9999999999999999999")
+	retailer, err := get_retailer(stub, args[0])
 	if err != nil {
-	  return shim.Error(err.Error())
+		return shim.Error(err.Error())
 	}
-	defer productlistingcontractsIterator.Close()
 
-	for productlistingcontractsIterator.HasNext() {
-	  aKeyValue, err := productlistingcontractsIterator.Next()
-	  if err != nil {
-	    return shim.Error(err.Error())
-	  }
-	  queryValAsBytes := aKeyValue.Value
-	  var productlistingcontract ProductListingContract
-	  json.Unmarshal(queryValAsBytes, &productlistingcontract)                  //un stringify it aka JSON.parse()
-	  everything.ProductListingContracts = append(everything.ProductListingContracts, productlistingcontract)   //add this marble to the list
+	totals := quantityTotals{}
+	for _, productId := range dedupe_strings(retailer.Products) {
+		held, unit, err := held_quantity(stub, retailer, productId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if held.Sign() == 0 {
+			continue
+		}
+		err = totals.add(format_decimal(held), unit)
+		if err != nil {
+			return shim.Error("Product " + productId + " - " + err.Error())
+		}
 	}
+	return quantity_totals_response(args[0], totals, args[1:])
+}
 
-	fmt.Println("result", everything)
+func quantity_totals_response(id string, totals quantityTotals, displayUnit []string) pb.Response {
+	type Totals struct {
+		Id     string          `json:"id"`
+		Totals []QuantityTotal `json:"totals"`
+	}
 
-	//change to array of bytes
-	everythingAsBytes, _ := json.Marshal(everything)              //convert to array of bytes
-	return shim.Success(everythingAsBytes)
+	unit := ""
+	if len(displayUnit) > 0 {
+		unit = displayUnit[0]
+	}
+	list, err := totals.list(unit)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	totalsAsBytes, _ := json.Marshal(Totals{Id: id, Totals: list})
+	fmt.Println("- end quantity totals")
+	return shim.Success(totalsAsBytes)
 }
 
 // ============================================================================================================================
@@ -225,16 +327,18 @@ func read_everything(stub shim.ChaincodeStubInterface) pb.Response {
 // Shows Off GetHistoryForKey() - reading complete history of a key/value
 //
 // Inputs - Array of strings
-//  0
-//  id
-//  "m01490985296352SjAyM"
+//
+//	0
+//	id
+//	"m01490985296352SjAyM"
+//
 // ============================================================================================================================
 func getHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	type AuditHistory struct {
-		TxId    string   `json:"txId"`
-		Value   Product   `json:"value"`
+		TxId  string  `json:"txId"`
+		Value Product `json:"value"`
 	}
-	var history []AuditHistory;
+	var history []AuditHistory
 	var product Product
 
 	if len(args) != 1 {
@@ -245,7 +349,11 @@ func getHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	fmt.Printf("- start getHistoryForProduct: %s\n", productId)
 
 	// Get History
-	resultsIterator, err := stub.GetHistoryForKey(productId)
+	productKey, err := entity_key(stub, productNamespace, productId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	resultsIterator, err := stub.GetHistoryForKey(productKey)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -258,21 +366,21 @@ func getHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 		}
 
 		var tx AuditHistory
-		tx.TxId = historyData.TxId                     //copy transaction id over
-		json.Unmarshal(historyData.Value, &product)     //un stringify it aka JSON.parse()
-		if historyData.Value == nil {                  //marble has been deleted
+		tx.TxId = historyData.TxId                  //copy transaction id over
+		json.Unmarshal(historyData.Value, &product) //un stringify it aka JSON.parse()
+		if historyData.Value == nil {               //marble has been deleted
 			var emptyProduct Product
-			tx.Value = emptyProduct                 //copy nil marble
+			tx.Value = emptyProduct //copy nil marble
 		} else {
 			json.Unmarshal(historyData.Value, &product) //un stringify it aka JSON.parse()
-			tx.Value = product                      //copy marble over
+			tx.Value = product                          //copy marble over
 		}
-		history = append(history, tx)              //add this tx to the list
+		history = append(history, tx) //add this tx to the list
 	}
 	fmt.Printf("- getHistoryForMarble returning:\n%s", history)
 
 	//change to array of bytes
-	historyAsBytes, _ := json.Marshal(history)     //convert to array of bytes
+	historyAsBytes, _ := json.Marshal(history) //convert to array of bytes
 	return shim.Success(historyAsBytes)
 }
 
@@ -282,9 +390,11 @@ func getHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 // Shows Off GetStateByRange() - reading a multiple key/values from the ledger
 //
 // Inputs - Array of strings
-//       0     ,    1
-//   startKey  ,  endKey
-//  "marbles1" , "marbles5"
+//
+//	     0     ,    1
+//	 startKey  ,  endKey
+//	"marbles1" , "marbles5"
+//
 // ============================================================================================================================
 func getMarblesByRange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	if len(args) != 2 {
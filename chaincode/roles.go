@@ -0,0 +1,189 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Roles - what a caller may do, from the attributes the CA put in its enrollment certificate
+//
+//   food.role    - supplier, importer, retailer, broker or regulator
+//   food.country - country the participant operates in, eg US
+//
+// Register identities with these attributes marked ecert:true so they are included in the certificate.
+// ============================================================================================================================
+
+const (
+	RoleSupplier  = "supplier"
+	RoleImporter  = "importer"
+	RoleRetailer  = "retailer"
+	RoleBroker    = "broker"
+	RoleRegulator = "regulator"
+)
+
+const (
+	roleAttribute    = "food.role"
+	countryAttribute = "food.country"
+)
+
+// write functions each role may invoke, functions not listed here are not role checked (reads)
+var rolePermissions = map[string][]string{
+	RoleSupplier: {
+		"init_user", "update_user", "init_product", "init_product_listing", "transfer_product_listing",
+	},
+	RoleImporter: {
+		"init_user", "update_user", "transfer_product_listing", "submit_hazard_analysis", "record_disposition",
+		"split_product_listing", "init_consignment", "grant_delegation", "revoke_delegation",
+	},
+	RoleRetailer: {
+		"init_user", "update_user", "sell_product", "dispose_product", "write_off_product",
+	},
+	// customs brokers invoke importer operations, only in the name of importers that delegated them, see delegation.go
+	RoleBroker: {
+		"init_user", "update_user", "transfer_product_listing", "submit_hazard_analysis", "record_disposition",
+		"split_product_listing", "init_consignment",
+	},
+	RoleRegulator: {
+		"init_regulator", "update_user", "check_products", "update_exempted_list", "approve_hazard_analysis",
+		"reject_hazard_analysis", "reject_listing", "suspend_participant", "reinstate_participant",
+		"set_risk_policy", "sign_off_listing",
+	},
+}
+
+type CallerRole struct {
+	Id          string   `json:"id"`
+	MSPId       string   `json:"mspId"`
+	Role        string   `json:"role"`
+	Country     string   `json:"country"`
+	Permissions []string `json:"permissions"`
+	Admin       bool     `json:"admin"` // may run the maintenance functions, see admin.go
+}
+
+func is_role(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func is_role_checked(function string) bool {
+	for _, functions := range rolePermissions {
+		if contains_string(functions, function) {
+			return true
+		}
+	}
+	return false
+}
+
+// ============================================================================================================================
+// read_caller_role() - id, role and country of the transaction creator
+// ============================================================================================================================
+func read_caller_role(stub shim.ChaincodeStubInterface) (CallerRole, error) {
+	var caller CallerRole
+	var err error
+
+	caller.Id, err = get_caller_id(stub)
+	if err != nil {
+		return caller, err
+	}
+	caller.MSPId, err = cid.GetMSPID(stub)
+	if err != nil {
+		return caller, errors.New("Could not read the caller's MSP - " + err.Error())
+	}
+	role, found, err := cid.GetAttributeValue(stub, roleAttribute)
+	if err != nil {
+		return caller, errors.New("Could not read the caller's " + roleAttribute + " attribute - " + err.Error())
+	}
+	if found && !is_role(role) {
+		return caller, errors.New("Caller " + caller.Id + " has unknown role " + role)
+	}
+	caller.Role = role
+	caller.Country, _, err = cid.GetAttributeValue(stub, countryAttribute)
+	if err != nil {
+		return caller, errors.New("Could not read the caller's " + countryAttribute + " attribute - " + err.Error())
+	}
+	caller.Permissions = rolePermissions[caller.Role]
+	if caller.Permissions == nil {
+		caller.Permissions = []string{}
+	}
+	return caller, nil
+}
+
+// ============================================================================================================================
+// check_role() - refuse a write function the caller's role does not allow, called from Invoke() before dispatching
+// ============================================================================================================================
+func check_role(stub shim.ChaincodeStubInterface, function string) error {
+	if !is_role_checked(function) {
+		return nil
+	}
+	caller, err := read_caller_role(stub)
+	if err != nil {
+		return err
+	}
+	if len(caller.Role) == 0 {
+		return errors.New("Caller " + caller.Id + " has no " + roleAttribute + " attribute, cannot invoke " + function)
+	}
+	if !contains_string(caller.Permissions, function) {
+		return errors.New("Role " + caller.Role + " cannot invoke " + function)
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Get Caller Role - the caller's effective role and the write functions it may invoke
+//
+// Inputs - none
+// Returns:
+//
+//	{
+//		"id": "importer1",
+//		"mspId": "Org1MSP",
+//		"role": "importer",
+//		"country": "US",
+//		"permissions": ["init_user", "transfer_product_listing", ...],
+//		"admin": false
+//	}
+//
+// ============================================================================================================================
+func get_caller_role(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting get_caller_role")
+
+	if len(args) != 0 {
+		return shim.Error("Incorrect number of arguments. Expecting 0")
+	}
+	caller, err := read_caller_role(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	caller.Admin, err = is_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	callerAsBytes, _ := json.Marshal(caller)
+	fmt.Println("- end get_caller_role")
+	return shim.Success(callerAsBytes)
+}
@@ -0,0 +1,454 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Schemas - the documents the init_* functions accept
+//
+// Every init_* function takes a single JSON object argument, checked against the JSON Schema published for it by
+// get_schema before anything is read or written. The positional arguments the functions took before are still
+// accepted: they are turned into the same document and checked against the same schema.
+//
+// Only the part of JSON Schema draft-07 the schemas below use is implemented: type, properties, required,
+// additionalProperties, dependencies, minLength, maxLength, enum, format, items, minItems, maxItems and uniqueItems.
+// The formats are the field validators in fields.go, so a value is checked the same way whether it is a positional argument or in
+// a document. Every problem is reported with the path of the field it is in, eg "profile.email" or "productIds[1]". The checks a schema cannot
+// express, such as what each role registers with or a production date in the future, run once the document matches
+// and are reported the same way.
+// ============================================================================================================================
+
+const schemaDialect = "http://json-schema.org/draft-07/schema#"
+
+type JsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Id                   string                 `json:"$id,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type"`
+	Properties           map[string]*JsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Dependencies         map[string][]string    `json:"dependencies,omitempty"`
+	MinLength            int                    `json:"minLength,omitempty"`
+	MaxLength            int                    `json:"maxLength,omitempty"`
+	Format               string                 `json:"format,omitempty"` // see fieldFormats
+	Enum                 []string               `json:"enum,omitempty"`
+	Items                *JsonSchema            `json:"items,omitempty"`
+	MinItems             int                    `json:"minItems,omitempty"`
+	MaxItems             int                    `json:"maxItems,omitempty"`
+	UniqueItems          bool                   `json:"uniqueItems,omitempty"`
+}
+
+// ========================================================
+// Schema builders
+// ========================================================
+func string_schema(description string, minLength int, maxLength int) *JsonSchema {
+	return &JsonSchema{Type: "string", Description: description, MinLength: minLength, MaxLength: maxLength}
+}
+
+func format_schema(description string, format string) *JsonSchema {
+	return &JsonSchema{Type: "string", Description: description, Format: format}
+}
+
+func id_schema(description string) *JsonSchema {
+	schema := format_schema(description, "id")
+	schema.MaxLength = maxIdLength
+	return schema
+}
+
+func id_list_schema(description string, minItems int) *JsonSchema {
+	return &JsonSchema{Type: "array", Description: description, Items: id_schema(""), MinItems: minItems, UniqueItems: true}
+}
+
+func object_schema(description string, properties map[string]*JsonSchema, required ...string) *JsonSchema {
+	closed := false
+	return &JsonSchema{Type: "object", Description: description, Properties: properties, Required: required, AdditionalProperties: &closed}
+}
+
+// the profile update_user accepts, see profile.go
+func profile_schema() *JsonSchema {
+	properties := map[string]*JsonSchema{}
+	for field, limit := range profileFields {
+		if field != "address" {
+			properties[field] = string_schema("", 0, limit)
+		}
+	}
+	addressProperties := map[string]*JsonSchema{}
+	for field, limit := range addressFields {
+		addressProperties[field] = string_schema("", 0, limit)
+	}
+	properties["address"] = object_schema("", addressProperties)
+	return object_schema("Legal name, contact details and address, as update_user takes them", properties)
+}
+
+func unit_names() []string {
+	var names []string
+	for name := range unitsOfMeasure {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func document_schema(function string, description string, properties map[string]*JsonSchema, required ...string) *JsonSchema {
+	schema := object_schema(description, properties, required...)
+	schema.Schema = schemaDialect
+	schema.Id = "food-supply/" + function
+	schema.Title = function
+	return schema
+}
+
+// by the function they are for
+var initSchemas = map[string]*JsonSchema{
+	"init_product": func() *JsonSchema {
+		unit := string_schema("Unit the quantity is in, defaults to units", 0, 0)
+		unit.Enum = unit_names()
+		schema := document_schema("init_product", "A product, created by its supplier", map[string]*JsonSchema{
+			"id":             id_schema("Product id"),
+			"quantity":       format_schema("Decimal number greater than zero, eg 12.5, a whole number for units and cases", "quantity"),
+			"countryId":      format_schema("ISO 3166 code of the country the product comes from", "country"),
+			"unit":           unit,
+			"lotNumber":      id_schema("Lot number, given together with the production and best before dates"),
+			"productionDate": format_schema("YYYY-MM-DD, not in the future", "date"),
+			"bestBefore":     format_schema("YYYY-MM-DD, not before the production date", "date"),
+			"category":       id_schema("Category that exemptions and hazard rules can name, eg shellfish"),
+			"gtin":           format_schema("GS1 trade item number, GTIN-8, 12, 13 or 14, optionally with the (01) prefix", "gtin"),
+			"description":    format_schema(fmt.Sprintf("Free text, up to %d characters", maxTextLength), "text"),
+		}, "id", "quantity", "countryId")
+		schema.Dependencies = map[string][]string{
+			"lotNumber":      {"productionDate", "bestBefore"},
+			"productionDate": {"lotNumber", "bestBefore"},
+			"bestBefore":     {"lotNumber", "productionDate"},
+		}
+		return schema
+	}(),
+	"init_product_listing": document_schema("init_product_listing", "A listing of products, created by their supplier", map[string]*JsonSchema{
+		"id":         id_schema("Listing id"),
+		"supplierId": id_schema("Supplier creating the listing"),
+		"productIds": id_list_schema("Products in the listing, none of them expired", 1),
+	}, "id", "supplierId", "productIds"),
+	"init_user": func() *JsonSchema {
+		userType := string_schema("Must match the food.role attribute of the caller's certificate", 0, 0)
+		userType.Enum = []string{RoleSupplier, RoleImporter, RoleRetailer, RoleBroker}
+		return document_schema("init_user", "Registers the caller as a supplier, importer, retailer or customs broker", map[string]*JsonSchema{
+			"id":            id_schema("Common name of the caller's certificate"),
+			"type":          userType,
+			"countryId":     format_schema("Suppliers only, defaults to and must match the food.country attribute of the caller's certificate", "country"),
+			"orgId":         id_schema("Suppliers only, required"),
+			"licenseNumber": id_schema("Customs brokers only, required"),
+			"profile":       profile_schema(),
+		}, "id")
+	}(),
+	"init_regulator": document_schema("init_regulator", "Registers the caller as a regulator", map[string]*JsonSchema{
+		"id":        id_schema("Common name of the caller's certificate"),
+		"countryId": format_schema("Defaults to and must match the food.country attribute of the caller's certificate", "country"),
+		"profile":   profile_schema(),
+	}, "id"),
+	"init_consignment": document_schema("init_consignment", "Listings an importer holds, grouped to be checked together", map[string]*JsonSchema{
+		"id":         id_schema("Consignment id, not used by a listing"),
+		"importerId": id_schema("Importer holding the listings"),
+		"listingIds": id_list_schema("At least 2 different listings awaiting their exempt check", 2),
+	}, "id", "importerId", "listingIds"),
+}
+
+// fields acl_requests() reads from a document, in the order of the positional arguments
+var initDocumentArguments = map[string][]string{
+	"init_product":         {"id"},
+	"init_product_listing": {"id", "supplierId", "productIds"},
+	"init_user":            {"id"},
+	"init_regulator":       {"id"},
+	"init_consignment":     {"id", "importerId", "listingIds"},
+}
+
+// ========================================================
+// Documents the init_* functions parse their arguments into
+// ========================================================
+type ProductDocument struct {
+	Id             string `json:"id"`
+	Quantity       string `json:"quantity"`
+	CountryId      string `json:"countryId"`
+	Unit           string `json:"unit"`
+	LotNumber      string `json:"lotNumber"`
+	ProductionDate string `json:"productionDate"`
+	BestBefore     string `json:"bestBefore"`
+	Category       string `json:"category"`
+	Gtin           string `json:"gtin"`
+	Description    string `json:"description"`
+}
+
+type ProductListingDocument struct {
+	Id         string   `json:"id"`
+	SupplierId string   `json:"supplierId"`
+	ProductIds []string `json:"productIds"`
+}
+
+type UserDocument struct {
+	Id            string   `json:"id"`
+	Type          string   `json:"type"`
+	CountryId     string   `json:"countryId"`
+	OrgId         string   `json:"orgId"`
+	LicenseNumber string   `json:"licenseNumber"`
+	Profile       *Profile `json:"profile"`
+}
+
+type RegulatorDocument struct {
+	Id        string   `json:"id"`
+	CountryId string   `json:"countryId"`
+	Profile   *Profile `json:"profile"`
+}
+
+type ConsignmentDocument struct {
+	Id         string   `json:"id"`
+	ImporterId string   `json:"importerId"`
+	ListingIds []string `json:"listingIds"`
+}
+
+// ============================================================================================================================
+// validate() - every problem with a value, "path: problem", nil if there are none
+// ============================================================================================================================
+func (schema *JsonSchema) validate(path string, value interface{}) []string {
+	at := func(problem string) []string {
+		if len(path) == 0 {
+			return []string{problem}
+		}
+		return []string{path + ": " + problem}
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return at("must be an object")
+		}
+		return schema.validate_object(path, object)
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return at("must be an array")
+		}
+		var problems []string
+		if len(items) == 0 && schema.MinItems == 1 {
+			problems = append(problems, at("must not be empty")...)
+		} else if len(items) < schema.MinItems {
+			problems = append(problems, at(fmt.Sprintf("must have at least %d items", schema.MinItems))...)
+		}
+		if schema.MaxItems > 0 && len(items) > schema.MaxItems {
+			problems = append(problems, at(fmt.Sprintf("must have at most %d items", schema.MaxItems))...)
+		}
+		if schema.Items != nil {
+			for i, item := range items {
+				problems = append(problems, schema.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)...)
+			}
+		}
+		if schema.UniqueItems {
+			seen := map[string]bool{}
+			for i, item := range items {
+				itemAsBytes, _ := json.Marshal(item)
+				if seen[string(itemAsBytes)] {
+					problems = append(problems, at(fmt.Sprintf("must not repeat items, %s is repeated at [%d]", itemAsBytes, i))...)
+				}
+				seen[string(itemAsBytes)] = true
+			}
+		}
+		return problems
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return at("must be a string")
+		}
+		length := utf8.RuneCountInString(s)
+		if length < schema.MinLength {
+			if schema.MinLength == 1 {
+				return at("must be a non-empty string")
+			}
+			return at(fmt.Sprintf("must be at least %d characters", schema.MinLength))
+		}
+		if schema.MaxLength > 0 && length > schema.MaxLength {
+			return at(fmt.Sprintf("must be <= %d characters", schema.MaxLength))
+		}
+		if len(schema.Enum) > 0 && !contains_string(schema.Enum, s) {
+			return at("must be one of " + strings.Join(schema.Enum, ", "))
+		}
+		if len(schema.Format) > 0 {
+			if problem := fieldFormats[schema.Format](s); len(problem) > 0 {
+				return at(problem)
+			}
+		}
+	}
+	return nil
+}
+
+func (schema *JsonSchema) validate_object(path string, object map[string]interface{}) []string {
+	field := func(name string) string {
+		if len(path) == 0 {
+			return name
+		}
+		return path + "." + name
+	}
+
+	var problems []string
+	for _, name := range schema.Required {
+		if _, ok := object[name]; !ok {
+			problems = append(problems, field(name)+": required")
+		}
+	}
+
+	var names []string
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names) // map order differs between peers
+	for _, name := range names {
+		property, ok := schema.Properties[name]
+		if !ok {
+			if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+				problems = append(problems, field(name)+": not allowed")
+			}
+			continue
+		}
+		problems = append(problems, property.validate(field(name), object[name])...)
+
+		for _, dependency := range schema.Dependencies[name] {
+			if _, ok := object[dependency]; !ok && !contains_string(problems, field(dependency)+": required with "+name) {
+				problems = append(problems, field(dependency)+": required with "+name)
+			}
+		}
+	}
+	return problems
+}
+
+// ============================================================================================================================
+// parse_document() - parse an init_* function's arguments into its document
+//
+// The arguments are either one JSON object or the function's positional arguments, which positional() turns into the
+// same document. Either way the document is checked against the function's schema, and every problem is reported.
+// ============================================================================================================================
+func parse_document(function string, args []string, positional func([]string) (map[string]interface{}, error), document interface{}) error {
+	var fields map[string]interface{}
+	if is_document_argument(args) {
+		err := json.Unmarshal([]byte(args[0]), &fields)
+		if err != nil || fields == nil {
+			return errors.New(function + " document must be a JSON object")
+		}
+	} else {
+		var err error
+		fields, err = positional(args)
+		if err != nil {
+			return err
+		}
+	}
+
+	problems := initSchemas[function].validate("", fields)
+	if len(problems) > 0 {
+		return document_error(function, problems)
+	}
+	fieldsAsBytes, _ := json.Marshal(fields)
+	return json.Unmarshal(fieldsAsBytes, document)
+}
+
+func is_document_argument(args []string) bool {
+	return len(args) == 1 && strings.HasPrefix(strings.TrimSpace(args[0]), "{")
+}
+
+func document_error(function string, problems []string) error {
+	sort.Strings(problems)
+	return errors.New("Invalid " + function + " document - " + strings.Join(problems, "; "))
+}
+
+// ============================================================================================================================
+// document_arguments() - an init_* function's document as the positional arguments it replaces
+//
+// The ACL checks in acl.go find the ids they need by position. Anything that cannot be read is left empty, the
+// function reports the problem itself.
+// ============================================================================================================================
+func document_arguments(function string, args []string) []string {
+	names, ok := initDocumentArguments[function]
+	if !ok || !is_document_argument(args) {
+		return args
+	}
+	var fields map[string]interface{}
+	json.Unmarshal([]byte(args[0]), &fields)
+
+	var positional []string
+	for _, name := range names {
+		switch value := fields[name].(type) {
+		case string:
+			positional = append(positional, value)
+		case []interface{}:
+			for _, item := range value {
+				s, _ := item.(string)
+				positional = append(positional, s)
+			}
+		default:
+			positional = append(positional, "")
+		}
+	}
+	return positional
+}
+
+// ============================================================================================================================
+// Get Schema - read the JSON Schema of the document an init_* function takes
+//
+// Inputs - Array of strings
+//
+//	      0
+//	 function name (optional)
+//	"init_product"
+//
+// Returns - the function's schema, or every schema by function name if none is given
+// ============================================================================================================================
+func get_schema(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting get_schema")
+
+	if len(args) > 1 {
+		return shim.Error("Incorrect number of arguments. Expecting an optional function name")
+	}
+
+	var schemaAsBytes []byte
+	if len(args) == 1 {
+		schema, ok := initSchemas[args[0]]
+		if !ok {
+			var functions []string
+			for function := range initSchemas {
+				functions = append(functions, function)
+			}
+			sort.Strings(functions)
+			return shim.Error("No schema for " + args[0] + ". Expecting one of " + strings.Join(functions, ", "))
+		}
+		schemaAsBytes, _ = json.Marshal(schema)
+	} else {
+		schemaAsBytes, _ = json.Marshal(initSchemas)
+	}
+
+	fmt.Println("- end get_schema")
+	return shim.Success(schemaAsBytes)
+}
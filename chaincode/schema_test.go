@@ -0,0 +1,204 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	cases := []struct {
+		function string
+		document string
+		problems []string
+	}{
+		{"init_product", `{"id": "p1", "quantity": "12.5", "countryId": "US", "unit": "kg"}`, nil},
+		{"init_product", `{"id": "p1", "quantity": "12", "countryId": "US", "lotNumber": "L1", "productionDate": "2018-01-01", "bestBefore": "2018-06-01",
+			"gtin": "(01)09506000134352", "category": "shellfish", "description": "Oysters"}`, nil},
+		{"init_product", `{}`, []string{"id: required", "quantity: required", "countryId: required"}},
+		{"init_product", `{"id": "p 1", "quantity": "0", "countryId": "USA", "unit": "tonnes"}`, []string{
+			"countryId: must be an ISO 3166 country code, eg US",
+			"id: must contain only letters, digits and - _ . : @ ( )",
+			"quantity: must be a decimal number greater than 0 and at most 1000000000, with up to 6 decimal places",
+			"unit: must be one of cases, kg, lb, litres, units"}},
+		{"init_product", `{"id": "p1", "quantity": 12, "countryId": "US", "colour": "red"}`, []string{
+			"colour: not allowed", "quantity: must be a string"}},
+		{"init_product", `{"id": "p1", "quantity": "12", "countryId": "US", "lotNumber": "L1"}`, []string{
+			"productionDate: required with lotNumber", "bestBefore: required with lotNumber"}},
+		{"init_product", `{"id": "p1", "quantity": "12", "countryId": "US", "bestBefore": "2018-06-01", "productionDate": "2018-01-01"}`, []string{
+			"lotNumber: required with bestBefore", "lotNumber: required with productionDate"}},
+		{"init_product", `{"id": "p1", "quantity": "12", "countryId": "US", "gtin": "09506000134353"}`, []string{
+			"gtin: check digit does not match, expecting 2"}},
+		{"init_product", `{"id": "p1", "quantity": "12", "countryId": "US", "productionDate": "01/01/2018", "lotNumber": "L1", "bestBefore": "2018-06-01"}`, []string{
+			"productionDate: must be a date formatted YYYY-MM-DD"}},
+		{"init_product", `{"id": "` + strings.Repeat("a", maxIdLength+1) + `", "quantity": "12", "countryId": "US"}`, []string{
+			"id: must be <= 64 characters"}},
+
+		{"init_product_listing", `{"id": "l1", "supplierId": "supplier1", "productIds": ["p1", "p2"]}`, nil},
+		{"init_product_listing", `{"id": "l1", "supplierId": "supplier1", "productIds": []}`, []string{"productIds: must not be empty"}},
+		{"init_product_listing", `{"id": "l1", "supplierId": "supplier1", "productIds": "p1"}`, []string{"productIds: must be an array"}},
+		{"init_product_listing", `{"id": "l1", "supplierId": "supplier1", "productIds": ["p1", "p 2", 3]}`, []string{
+			"productIds[1]: must contain only letters, digits and - _ . : @ ( )", "productIds[2]: must be a string"}},
+		{"init_product_listing", `{"id": "l1", "supplierId": "supplier1", "productIds": ["p1", "p2", "p1", "p1"]}`, []string{
+			`productIds: must not repeat items, "p1" is repeated at [2]`, `productIds: must not repeat items, "p1" is repeated at [3]`}},
+
+		{"init_consignment", `{"id": "c1", "importerId": "importer1", "listingIds": ["l1", "l2"]}`, nil},
+		{"init_consignment", `{"id": "c1", "importerId": "importer1", "listingIds": ["l1"]}`, []string{"listingIds: must have at least 2 items"}},
+		{"init_consignment", `{"id": "c1", "importerId": "importer1", "listingIds": ["l1", "l1"]}`, []string{
+			`listingIds: must not repeat items, "l1" is repeated at [1]`}},
+
+		{"init_user", `{"id": "supplier1", "type": "supplier", "countryId": "US", "orgId": "org1",
+			"profile": {"legalName": "Acme Foods Inc.", "address": {"city": "Austin", "countryId": "US"}}}`, nil},
+		{"init_user", `{"id": "supplier1", "type": "farmer"}`, []string{"type: must be one of supplier, importer, retailer, broker"}},
+		{"init_user", `{"id": "supplier1", "profile": {"nickname": "acme", "address": {"planet": "earth"}}}`, []string{
+			"profile.address.planet: not allowed", "profile.nickname: not allowed"}},
+		{"init_user", `{"id": "supplier1", "profile": "Acme"}`, []string{"profile: must be an object"}},
+		{"init_regulator", `{"id": "regulator1", "countryId": "US"}`, nil},
+		{"init_regulator", `{"countryId": "us"}`, []string{"id: required", "countryId: must be an ISO 3166 country code, eg US"}},
+	}
+	for _, c := range cases {
+		var fields interface{}
+		if err := json.Unmarshal([]byte(c.document), &fields); err != nil {
+			t.Fatalf("%s %s: %s", c.function, c.document, err.Error())
+		}
+		problems := initSchemas[c.function].validate("", fields)
+		if !reflect.DeepEqual(problems, c.problems) {
+			t.Errorf("%s %s\n got %q\nwant %q", c.function, c.document, problems, c.problems)
+		}
+	}
+}
+
+func TestSchemaValidateTypes(t *testing.T) {
+	count := &JsonSchema{Type: "array", Items: string_schema("", 1, 3), MinItems: 2, MaxItems: 3}
+	cases := []struct {
+		schema   *JsonSchema
+		value    interface{}
+		problems []string
+	}{
+		{string_schema("", 1, 3), "abc", nil},
+		{string_schema("", 1, 3), "", []string{"must be a non-empty string"}},
+		{string_schema("", 2, 3), "a", []string{"must be at least 2 characters"}},
+		{string_schema("", 1, 3), "abcd", []string{"must be <= 3 characters"}},
+		{string_schema("", 1, 3), "été", nil}, // characters, not bytes
+		{string_schema("", 0, 0), strings.Repeat("a", 1000), nil},
+		{string_schema("", 0, 0), 1.0, []string{"must be a string"}},
+		{string_schema("", 0, 0), nil, []string{"must be a string"}},
+		{count, []interface{}{"a", "b"}, nil},
+		{count, []interface{}{"a"}, []string{"must have at least 2 items"}},
+		{count, []interface{}{"a", "b", "c", "d"}, []string{"must have at most 3 items"}},
+		{count, []interface{}{"a", "b", "a"}, nil}, // repeats are only refused with uniqueItems
+		{count, []interface{}{"a", ""}, []string{"[1]: must be a non-empty string"}},
+		{count, map[string]interface{}{}, []string{"must be an array"}},
+		{id_list_schema("", 0), []interface{}{}, nil},
+		{object_schema("", map[string]*JsonSchema{}), []interface{}{}, []string{"must be an object"}},
+		{&JsonSchema{Type: "object", Properties: map[string]*JsonSchema{}}, map[string]interface{}{"extra": 1.0}, nil}, // open object
+	}
+	for _, c := range cases {
+		problems := c.schema.validate("", c.value)
+		if !reflect.DeepEqual(problems, c.problems) {
+			t.Errorf("validate(%v) = %q, want %q", c.value, problems, c.problems)
+		}
+	}
+	if problems := count.validate("ids", []interface{}{"a"}); !reflect.DeepEqual(problems, []string{"ids: must have at least 2 items"}) {
+		t.Errorf("problems should carry the path, got %q", problems)
+	}
+}
+
+func TestParseDocument(t *testing.T) {
+	positional := func(args []string) (map[string]interface{}, error) {
+		if len(args) != 3 {
+			return nil, errors.New("Incorrect number of arguments")
+		}
+		return map[string]interface{}{"id": args[0], "supplierId": args[1], "productIds": []interface{}{args[2]}}, nil
+	}
+	cases := []struct {
+		args []string
+		want ProductListingDocument
+		err  string
+	}{
+		{[]string{`{"id": "l1", "supplierId": "supplier1", "productIds": ["p1", "p2"]}`},
+			ProductListingDocument{Id: "l1", SupplierId: "supplier1", ProductIds: []string{"p1", "p2"}}, ""},
+		{[]string{`  {"id": "l1", "supplierId": "supplier1", "productIds": ["p1"]}`},
+			ProductListingDocument{Id: "l1", SupplierId: "supplier1", ProductIds: []string{"p1"}}, ""},
+		{[]string{"l1", "supplier1", "p1"}, ProductListingDocument{Id: "l1", SupplierId: "supplier1", ProductIds: []string{"p1"}}, ""},
+		{[]string{"l1", "supplier1"}, ProductListingDocument{}, "Incorrect number of arguments"},
+		{[]string{"l 1", "supplier1", "p1"}, ProductListingDocument{},
+			"Invalid init_product_listing document - id: must contain only letters, digits and - _ . : @ ( )"},
+		{[]string{`{"id": "l1"`}, ProductListingDocument{}, "init_product_listing document must be a JSON object"},
+		{[]string{`{"id": "l1", "productIds": ["p1", "p1"]}`}, ProductListingDocument{},
+			`Invalid init_product_listing document - productIds: must not repeat items, "p1" is repeated at [1]; supplierId: required`},
+	}
+	for _, c := range cases {
+		var document ProductListingDocument
+		err := parse_document("init_product_listing", c.args, positional, &document)
+		if len(c.err) > 0 {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("parse_document(%q) = %v, want %q", c.args, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parse_document(%q): %s", c.args, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(document, c.want) {
+			t.Errorf("parse_document(%q) = %+v, want %+v", c.args, document, c.want)
+		}
+	}
+}
+
+func TestDocumentArguments(t *testing.T) {
+	cases := []struct {
+		function string
+		args     []string
+		want     []string
+	}{
+		{"init_product_listing", []string{`{"id": "l1", "supplierId": "supplier1", "productIds": ["p1", "p2"]}`}, []string{"l1", "supplier1", "p1", "p2"}},
+		{"init_product_listing", []string{`{"id": "l1", "productIds": ["p1", 2]}`}, []string{"l1", "", "p1", ""}},
+		{"init_product_listing", []string{"l1", "supplier1", "p1"}, []string{"l1", "supplier1", "p1"}},
+		{"init_consignment", []string{`{"listingIds": ["l1", "l2"], "importerId": "importer1", "id": "c1"}`}, []string{"c1", "importer1", "l1", "l2"}},
+		{"init_user", []string{`{"id": "supplier1", "type": "supplier"}`}, []string{"supplier1"}},
+		{"init_regulator", []string{`not json`}, []string{"not json"}},
+		{"transfer_product_listing", []string{`{"id": "l1"}`}, []string{`{"id": "l1"}`}},
+	}
+	for _, c := range cases {
+		if got := document_arguments(c.function, c.args); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("document_arguments(%s, %q) = %q, want %q", c.function, c.args, got, c.want)
+		}
+	}
+
+	// every document names its positional fields in its schema
+	for function, names := range initDocumentArguments {
+		schema, ok := initSchemas[function]
+		if !ok {
+			t.Errorf("%s has no schema", function)
+			continue
+		}
+		for _, name := range names {
+			if _, ok := schema.Properties[name]; !ok {
+				t.Errorf("%s schema has no %s", function, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,293 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Sign Off - several regulators deciding on a high risk listing
+//
+// Each country can set a risk policy: product categories and origin countries that make a listing high risk, a panel
+// of its regulators and how many of them must approve. A high risk listing that passes its exempt check or hazard
+// analysis goes to SIGNOFFREQ instead of CHECKCOMPLETED, and only reaches CHECKCOMPLETED once quorum panel members have
+// approved it with sign_off_listing(). A single rejection refuses the listing, as reject_listing() would.
+//
+// The panel and quorum are copied onto the listing when it is checked, so changing the policy does not affect listings
+// already being signed off.
+// ============================================================================================================================
+
+const (
+	SignOffApprove = "APPROVE"
+	SignOffReject  = "REJECT"
+)
+
+// ============================================================================================================================
+// assess_risk() - sign off the listing needs under its destination country's risk policy, nil if it is not high risk
+// ============================================================================================================================
+func assess_risk(stub shim.ChaincodeStubInterface, listing ProductListingContract, jurisdiction Jurisdiction) (*SignOff, error) {
+	policy := jurisdiction.HighRisk
+	if policy == nil || policy.Quorum == 0 {
+		return nil, nil
+	}
+
+	var reasons []string
+	for _, productId := range listing.Products {
+		product, err := get_product(stub, productId)
+		if err != nil {
+			return nil, err
+		}
+		if len(product.Category) > 0 && contains_string(policy.Categories, product.Category) {
+			reasons = append(reasons, "product "+product.Id+" is in high risk category "+product.Category)
+		}
+		if contains_string(policy.Origins, product.CountryId) {
+			reasons = append(reasons, "product "+product.Id+" originates from high risk country "+product.CountryId)
+		}
+	}
+	if len(reasons) == 0 {
+		return nil, nil
+	}
+	return &SignOff{
+		Quorum:  policy.Quorum,
+		Panel:   policy.Panel,
+		Reasons: reasons,
+		Votes:   []SignOffVote{},
+	}, nil
+}
+
+// ============================================================================================================================
+// cleared_status() - where a listing goes once it passes its check, CHECKCOMPLETED unless it still needs signing off
+// ============================================================================================================================
+func cleared_status(listing ProductListingContract) ListingStatus {
+	if listing.SignOff != nil {
+		return StatusSignOffReq
+	}
+	return StatusCheckCompleted
+}
+
+// ============================================================================================================================
+// Set Risk Policy - regulator sets what makes a listing high risk in its country and who must sign it off
+//
+// Inputs - Array of strings
+//
+//	      0     ,        1          ,      2        ,                      3                     ,    4
+//	regulator id, categories (JSON) , origins (JSON),                panel (JSON)                , quorum
+//	"regulator1", ["shellfish"]     , ["VN"]        , ["regulator1", "regulator2", "regulator3"] ,   "2"
+//
+// The panel members must be regulators of the same country. A quorum of 0 turns multi-regulator sign off off.
+//
+// Returns - the updated Jurisdiction
+// ============================================================================================================================
+func set_risk_policy(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	var policy RiskPolicy
+	fmt.Println("starting set_risk_policy")
+
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 5. regulator id, categories, origins, panel and quorum")
+	}
+
+	policy.Categories, err = parse_string_list(args[1], "Categories")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for i := range policy.Categories {
+		policy.Categories[i] = strings.ToLower(policy.Categories[i])
+	}
+	policy.Origins, err = parse_string_list(args[2], "Origins")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for i, origin := range policy.Origins {
+		err = check_field(fmt.Sprintf("origins[%d]", i), "country", origin)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	policy.Panel, err = parse_string_list(args[3], "Panel")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	policy.Panel = dedupe_strings(policy.Panel)
+	policy.Quorum, err = strconv.Atoi(args[4])
+	if err != nil || policy.Quorum < 0 {
+		return shim.Error("Quorum must be a whole number, 0 or more")
+	}
+	if policy.Quorum > len(policy.Panel) {
+		return shim.Error(fmt.Sprintf("Quorum of %d needs a panel of at least %d regulators", policy.Quorum, policy.Quorum))
+	}
+
+	regulator, err := get_regulator(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = assert_caller(stub, regulator.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(regulator.CountryId) == 0 {
+		return shim.Error("Regulator " + regulator.Id + " has no country, register it again with init_regulator")
+	}
+	for _, memberId := range policy.Panel {
+		member, err := get_regulator(stub, memberId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if member.CountryId != regulator.CountryId {
+			return shim.Error("Panel member " + member.Id + " does not regulate " + regulator.CountryId)
+		}
+	}
+
+	jurisdiction, err := get_jurisdiction(stub, regulator.CountryId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	jurisdiction.HighRisk = &policy
+	jurisdictionAsBytes, err := put_jurisdiction(stub, jurisdiction)
+	if err != nil {
+		fmt.Println("Could not store jurisdiction")
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_risk_policy")
+	return shim.Success(jurisdictionAsBytes)
+}
+
+// ============================================================================================================================
+// Sign Off Listing - a panel regulator approves or rejects a high risk listing
+//
+// The listing reaches CHECKCOMPLETED with the approval that meets the quorum. A rejection, which needs a reason,
+// refuses the listing straight away.
+//
+// Inputs - Array of strings
+//
+//	     0            ,       1      ,        2         ,      3
+//	listing id        , regulator id ,     decision     , reason (optional to approve)
+//
+// "productlistingcontract1", "regulator2" , APPROVE / REJECT , "lab results outside limits"
+//
+// Returns - the listing's SignOff
+// ============================================================================================================================
+func sign_off_listing(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting sign_off_listing")
+
+	if len(args) != 3 && len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting listing id, regulator id, decision and a reason")
+	}
+
+	vote := SignOffVote{RegulatorId: args[1], Decision: strings.ToUpper(args[2]), TxId: stub.GetTxID()}
+	if len(args) == 4 {
+		vote.Reason = strings.TrimSpace(args[3])
+	}
+	if vote.Decision != SignOffApprove && vote.Decision != SignOffReject {
+		return shim.Error("Invalid decision " + args[2] + ". Expecting APPROVE or REJECT")
+	}
+	if vote.Decision == SignOffReject && len(vote.Reason) == 0 {
+		return shim.Error("A reason is required to reject a listing")
+	}
+
+	regulator, err := get_regulator(stub, vote.RegulatorId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = assert_caller(stub, regulator.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	productListing, err := get_product_listing(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = check_jurisdiction(regulator, productListing)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = check_listing_action(productListing, ActionSignOff, "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	signOff := productListing.SignOff
+	if signOff == nil {
+		return shim.Error("Listing " + productListing.Id + " does not need signing off")
+	}
+	if !contains_string(signOff.Panel, regulator.Id) {
+		return shim.Error("Regulator " + regulator.Id + " is not on the sign off panel of listing " + productListing.Id)
+	}
+	for _, earlier := range signOff.Votes {
+		if earlier.RegulatorId == regulator.Id {
+			return shim.Error("Regulator " + regulator.Id + " has already signed off listing " + productListing.Id)
+		}
+	}
+	signOff.Votes = append(signOff.Votes, vote)
+
+	err = transition_listing(&productListing, ActionSignOff, signOff.verdict())
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if productListing.Status == StatusRejected {
+		productListing.Rejection = &ListingRejection{
+			RegulatorId: regulator.Id,
+			Reason:      vote.Reason,
+			TxId:        vote.TxId,
+		}
+	}
+
+	err = put_product_listing(stub, productListing)
+	if err != nil {
+		fmt.Println("Could not store product listing")
+		return shim.Error(err.Error())
+	}
+
+	signOffAsBytes, _ := json.Marshal(signOff)
+	fmt.Println("- end sign_off_listing")
+	return shim.Success(signOffAsBytes)
+}
+
+func (signOff SignOff) approvals() int {
+	count := 0
+	for _, vote := range signOff.Votes {
+		if vote.Decision == SignOffApprove {
+			count++
+		}
+	}
+	return count
+}
+
+// where the votes so far leave a listing: a single rejection refuses it, otherwise it is cleared once the approvals meet
+// the quorum and keeps waiting until then
+func (signOff SignOff) verdict() ListingStatus {
+	for _, vote := range signOff.Votes {
+		if vote.Decision == SignOffReject {
+			return StatusRejected
+		}
+	}
+	if signOff.approvals() >= signOff.Quorum {
+		return StatusCheckCompleted
+	}
+	return StatusSignOffReq
+}
@@ -0,0 +1,170 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func votes(decisions ...string) []SignOffVote {
+	var list []SignOffVote
+	for i, decision := range decisions {
+		list = append(list, SignOffVote{RegulatorId: "regulator" + string(rune('1'+i)), Decision: decision})
+	}
+	return list
+}
+
+func TestSignOffVerdict(t *testing.T) {
+	cases := []struct {
+		quorum    int
+		votes     []SignOffVote
+		approvals int
+		want      ListingStatus
+	}{
+		{2, nil, 0, StatusSignOffReq},
+		{2, votes(SignOffApprove), 1, StatusSignOffReq},
+		{2, votes(SignOffApprove, SignOffApprove), 2, StatusCheckCompleted},
+		{1, votes(SignOffApprove), 1, StatusCheckCompleted},
+		{3, votes(SignOffApprove, SignOffApprove), 2, StatusSignOffReq},
+		{3, votes(SignOffApprove, SignOffApprove, SignOffApprove), 3, StatusCheckCompleted},
+		{2, votes(SignOffReject), 0, StatusRejected},
+		{2, votes(SignOffApprove, SignOffReject), 1, StatusRejected},
+		{1, votes(SignOffApprove, SignOffReject), 1, StatusRejected}, // a rejection wins even past the quorum
+		{3, votes(SignOffApprove, SignOffApprove, SignOffReject), 2, StatusRejected},
+		{2, votes("approve", "ABSTAIN"), 0, StatusSignOffReq}, // only the decisions sign_off_listing() stores count
+	}
+	for _, c := range cases {
+		signOff := SignOff{Quorum: c.quorum, Panel: []string{"regulator1", "regulator2", "regulator3"}, Votes: c.votes}
+		if got := signOff.approvals(); got != c.approvals {
+			t.Errorf("quorum %d, votes %v: %d approvals, want %d", c.quorum, c.votes, got, c.approvals)
+		}
+		if got := signOff.verdict(); got != c.want {
+			t.Errorf("quorum %d, votes %v: verdict %s, want %s", c.quorum, c.votes, got, c.want)
+		}
+
+		// every verdict is a move the transition table allows
+		listing := ProductListingContract{Id: "l1", Status: StatusSignOffReq, OwnerType: "Importer", SignOff: &signOff}
+		if err := transition_listing(&listing, ActionSignOff, signOff.verdict()); err != nil {
+			t.Errorf("quorum %d, votes %v: %s", c.quorum, c.votes, err.Error())
+		}
+	}
+}
+
+func TestClearedStatus(t *testing.T) {
+	if status := cleared_status(ProductListingContract{Id: "l1"}); status != StatusCheckCompleted {
+		t.Errorf("a listing without sign off clears to %s, want %s", status, StatusCheckCompleted)
+	}
+	if status := cleared_status(ProductListingContract{Id: "l1", SignOff: &SignOff{Quorum: 1}}); status != StatusSignOffReq {
+		t.Errorf("a high risk listing clears to %s, want %s", status, StatusSignOffReq)
+	}
+}
+
+func TestAssessRisk(t *testing.T) {
+	stub := aclStateStub{state: map[string][]byte{}}
+	for _, product := range []Product{
+		{Id: "oysters", CountryId: "VN", Category: "shellfish"},
+		{Id: "mussels", CountryId: "NZ", Category: "shellfish"},
+		{Id: "rice", CountryId: "VN", Category: "grain"},
+		{Id: "apples", CountryId: "NZ", Category: "fruit"},
+		{Id: "honey", CountryId: "NZ"},
+	} {
+		productAsBytes, _ := json.Marshal(product)
+		key, _ := stub.CreateCompositeKey(productNamespace, []string{product.Id})
+		stub.state[key] = productAsBytes
+	}
+	policy := &RiskPolicy{Categories: []string{"shellfish"}, Origins: []string{"VN"}, Panel: []string{"regulator1", "regulator2"}, Quorum: 2}
+
+	cases := []struct {
+		products []string
+		policy   *RiskPolicy
+		reasons  []string // nil when the listing is not high risk
+	}{
+		{[]string{"apples", "honey"}, policy, nil},
+		{[]string{"mussels"}, policy, []string{"product mussels is in high risk category shellfish"}},
+		{[]string{"apples", "rice"}, policy, []string{"product rice originates from high risk country VN"}},
+		{[]string{"oysters"}, policy, []string{"product oysters is in high risk category shellfish", "product oysters originates from high risk country VN"}},
+		{[]string{"oysters"}, nil, nil},
+		{[]string{"oysters"}, &RiskPolicy{Categories: []string{"shellfish"}, Origins: []string{"VN"}}, nil}, // a quorum of 0 turns sign off off
+		{[]string{"honey"}, &RiskPolicy{Categories: []string{""}, Panel: []string{"regulator1"}, Quorum: 1}, nil},
+	}
+	for _, c := range cases {
+		listing := ProductListingContract{Id: "l1", Products: c.products}
+		signOff, err := assess_risk(stub, listing, Jurisdiction{CountryId: "US", HighRisk: c.policy})
+		if err != nil {
+			t.Errorf("%v: %s", c.products, err.Error())
+			continue
+		}
+		if c.reasons == nil {
+			if signOff != nil {
+				t.Errorf("%v: should not need sign off, got %v", c.products, signOff.Reasons)
+			}
+			continue
+		}
+		if signOff == nil {
+			t.Errorf("%v: should need sign off", c.products)
+			continue
+		}
+		if !reflect.DeepEqual(signOff.Reasons, c.reasons) {
+			t.Errorf("%v: reasons %q, want %q", c.products, signOff.Reasons, c.reasons)
+		}
+		if signOff.Quorum != c.policy.Quorum || !reflect.DeepEqual(signOff.Panel, c.policy.Panel) || signOff.Votes == nil || len(signOff.Votes) > 0 {
+			t.Errorf("%v: sign off %+v does not start from the policy", c.products, signOff)
+		}
+	}
+
+	if _, err := assess_risk(stub, ProductListingContract{Id: "l1", Products: []string{"missing"}}, Jurisdiction{HighRisk: policy}); err == nil {
+		t.Error("a listing with a missing product should fail")
+	}
+}
+
+type signOffStub struct {
+	aclStateStub
+}
+
+func (stub signOffStub) GetTxID() string {
+	return "tx1"
+}
+
+// the decision is checked before anything is read
+func TestSignOffDecision(t *testing.T) {
+	stub := signOffStub{aclStateStub{state: map[string][]byte{}}}
+	cases := []struct {
+		args  []string
+		error string
+	}{
+		{[]string{"l1", "regulator2"}, "Incorrect number of arguments"},
+		{[]string{"l1", "regulator2", "APPROVE", "fine", "extra"}, "Incorrect number of arguments"},
+		{[]string{"l1", "regulator2", "ABSTAIN"}, "Invalid decision ABSTAIN. Expecting APPROVE or REJECT"},
+		{[]string{"l1", "regulator2", ""}, "Invalid decision . Expecting APPROVE or REJECT"},
+		{[]string{"l1", "regulator2", "REJECT"}, "A reason is required to reject a listing"},
+		{[]string{"l1", "regulator2", "reject", "  "}, "A reason is required to reject a listing"},
+		{[]string{"l1", "regulator2", "reject", "lab results outside limits"}, "regulator2"}, // accepted, the regulator is looked up next
+		{[]string{"l1", "regulator2", "approve"}, "regulator2"},
+	}
+	for _, c := range cases {
+		response := sign_off_listing(stub, c.args)
+		if response.Status == 200 || !strings.Contains(response.Message, c.error) {
+			t.Errorf("sign_off_listing(%q) = %d %q, want an error with %q", c.args, response.Status, response.Message, c.error)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Retailer Stock - what a retailer holds and the ledger of every movement in and out
+//
+// Movements are stored under the composite key stockmovement~retailer~seq, seq zero padded so a range over the
+// retailer returns them in order.
+// ============================================================================================================================
+
+const (
+	StockReceived   = "RECEIVED"
+	StockSold       = "SOLD"
+	StockDisposed   = "DISPOSED"
+	StockWrittenOff = "WRITTEN_OFF"
+)
+
+const stockMovementIndex = "stockmovement"
+
+// ============================================================================================================================
+// held_quantity() - how much of a product a retailer holds, in the product's unit
+//
+// Retailers stored before holdings were kept received whole products, so a product without a holding counts in full.
+// ============================================================================================================================
+func held_quantity(stub shim.ChaincodeStubInterface, retailer Retailer, productId string) (*big.Rat, string, error) {
+	product, err := get_product(stub, productId)
+	if err != nil {
+		return nil, "", err
+	}
+	unit := product_unit(product)
+
+	amount, ok := retailer.Holdings[productId]
+	if !ok {
+		if !contains_string(retailer.Products, productId) {
+			return new(big.Rat), unit, nil
+		}
+		amount = product.Quantity
+	}
+	held, ok := new(big.Rat).SetString(amount)
+	if !ok {
+		return nil, "", errors.New("Retailer " + retailer.User.Id + " holds an invalid quantity of product " + productId)
+	}
+	return held, unit, nil
+}
+
+// ============================================================================================================================
+// record_stock_movement() - apply a movement to the retailer's holdings and append it to the stock ledger
+//
+// The caller stores the retailer afterwards.
+// ============================================================================================================================
+func record_stock_movement(stub shim.ChaincodeStubInterface, retailer *Retailer, productId string, movementType string, quantity *big.Rat, unit string, reference string) error {
+	held, productUnit, err := held_quantity(stub, *retailer, productId)
+	if err != nil {
+		return err
+	}
+	if unit != productUnit {
+		quantity, err = convert_quantity(quantity, unit, productUnit)
+		if err != nil {
+			return err
+		}
+	}
+
+	balance := new(big.Rat)
+	if movementType == StockReceived {
+		balance.Add(held, quantity)
+	} else {
+		if quantity.Cmp(held) > 0 {
+			return errors.New("Retailer " + retailer.User.Id + " holds " + format_decimal(held) + " " + productUnit + " of product " +
+				productId + ", cannot consume " + format_decimal(quantity))
+		}
+		balance.Sub(held, quantity)
+	}
+
+	if retailer.Holdings == nil {
+		retailer.Holdings = map[string]string{}
+	}
+	if balance.Sign() > 0 {
+		retailer.Holdings[productId] = format_decimal(balance)
+		if !contains_string(retailer.Products, productId) {
+			retailer.Products = append(retailer.Products, productId)
+		}
+	} else {
+		var products []string
+		for _, id := range retailer.Products {
+			if id != productId {
+				products = append(products, id)
+			}
+		}
+		retailer.Products = products
+		retailer.Holdings = without_holding(retailer.Holdings, productId)
+	}
+
+	retailer.StockSeq++
+	movement := StockMovement{
+		RetailerId: retailer.User.Id,
+		Seq:        retailer.StockSeq,
+		ProductId:  productId,
+		Type:       movementType,
+		Quantity:   format_decimal(quantity),
+		Unit:       productUnit,
+		Balance:    format_decimal(balance),
+		Reference:  reference,
+		TxId:       stub.GetTxID(),
+	}
+	// never write over a recorded movement, even if the sequence on the retailer was lost
+	var movementKey string
+	for {
+		movementKey, err = stub.CreateCompositeKey(stockMovementIndex, []string{movement.RetailerId, fmt.Sprintf("%010d", movement.Seq)})
+		if err != nil {
+			return err
+		}
+		recorded, err := stub.GetState(movementKey)
+		if err != nil {
+			return err
+		}
+		if recorded == nil {
+			break
+		}
+		movement.Seq++
+	}
+	retailer.StockSeq = movement.Seq
+	movementAsBytes, _ := json.Marshal(movement)
+	return stub.PutState(movementKey, movementAsBytes)
+}
+
+// the builtin is shadowed by delete() in write_ledger.go, so rebuild the map without the product
+func without_holding(holdings map[string]string, productId string) map[string]string {
+	kept := map[string]string{}
+	for id, amount := range holdings {
+		if id != productId {
+			kept[id] = amount
+		}
+	}
+	return kept
+}
+
+// ============================================================================================================================
+// Consume Stock - retailer sells, disposes of or writes off part of what it holds
+//
+// Dispatched as sell_product, dispose_product and write_off_product. A reason is required to dispose or write off.
+//
+// Inputs - Array of strings
+//
+//	     0      ,     1     ,    2     ,                  3
+//	retailer id , product id, quantity , reference (receipt number, or reason)
+//	"retailer1" , "product1",   "2.5"  ,            "POS-000123"
+//
+// quantity is in the product's unit
+// ============================================================================================================================
+func consume_stock(stub shim.ChaincodeStubInterface, args []string, movementType string) pb.Response {
+	var err error
+	fmt.Println("starting consume_stock " + movementType)
+
+	if len(args) != 3 && len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting retailer id, product id, quantity and a reference")
+	}
+
+	reference := ""
+	if len(args) == 4 {
+		reference = strings.TrimSpace(args[3])
+	}
+	if movementType != StockSold && len(reference) == 0 {
+		return shim.Error("A reason is required to record " + strings.ToLower(movementType) + " stock")
+	}
+
+	retailer, err := get_retailer(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = assert_caller(stub, retailer.User.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	product, err := get_product(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	quantity, err := parse_quantity(args[2], product_unit(product))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = record_stock_movement(stub, &retailer, product.Id, movementType, quantity, product_unit(product), reference)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = put_participant(stub, retailer)
+	if err != nil {
+		fmt.Println("Could not store retailer")
+		return shim.Error(err.Error())
+	}
+
+	retailerAsBytes, _ := json.Marshal(retailer)
+	fmt.Println("- end consume_stock")
+	return shim.Success(retailerAsBytes)
+}
+
+// ============================================================================================================================
+// Get Stock Ledger - a retailer's stock movements, oldest first
+//
+// Inputs - Array of strings
+//
+//	     0      ,          1
+//	retailer id , product id (optional)
+//	"retailer1" ,      "product1"
+//
+// ============================================================================================================================
+func get_stock_ledger(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting get_stock_ledger")
+
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting retailer id and an optional product id")
+	}
+	retailer, err := get_retailer(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(stockMovementIndex, []string{retailer.User.Id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	movements := []StockMovement{}
+	for resultsIterator.HasNext() {
+		aKeyValue, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var movement StockMovement
+		json.Unmarshal(aKeyValue.Value, &movement)
+		if len(args) == 2 && movement.ProductId != args[1] {
+			continue
+		}
+		movements = append(movements, movement)
+	}
+
+	movementsAsBytes, _ := json.Marshal(movements)
+	fmt.Println("- end get_stock_ledger")
+	return shim.Success(movementsAsBytes)
+}
@@ -0,0 +1,380 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Suspension - a regulator disabling a supplier, importer, retailer or broker
+//
+// From its effective date a suspended participant cannot have listings created for it, transferred to or from it or
+// checked, and cannot act as a broker, until a regulator reinstates it. The suspension in force is kept on the
+// participant record; every suspension and reinstatement is logged under suspensionevent~participant~seq.
+// ============================================================================================================================
+
+const (
+	SuspensionSuspended  = "SUSPENDED"
+	SuspensionReinstated = "REINSTATED"
+
+	suspensionEventIndex = "suspensionevent"
+)
+
+// ============================================================================================================================
+// get_suspension() - suspension on a participant's record, nil if it has none
+// ============================================================================================================================
+func get_suspension(stub shim.ChaincodeStubInterface, id string) (*SuspensionEvent, error) {
+	var participant struct {
+		Suspension *SuspensionEvent `json:"suspension"`
+	}
+	participantAsBytes, err := get_entity_state(stub, participantNamespace, id)
+	if err != nil {
+		return nil, errors.New("Failed to get participant - " + id)
+	}
+	if participantAsBytes == nil {
+		return nil, nil
+	}
+	json.Unmarshal(participantAsBytes, &participant)
+	return participant.Suspension, nil
+}
+
+// ============================================================================================================================
+// put_suspension() - replace the suspension on a stored participant, nil lifts it
+// ============================================================================================================================
+func put_suspension(stub shim.ChaincodeStubInterface, id string, suspension *SuspensionEvent) error {
+	var participant map[string]json.RawMessage
+	participantAsBytes, err := get_entity_state(stub, participantNamespace, id)
+	if err != nil {
+		return errors.New("Failed to get participant - " + id)
+	}
+	err = json.Unmarshal(participantAsBytes, &participant)
+	if err != nil || participant == nil {
+		return errors.New("Participant does not exist - " + id)
+	}
+	if suspension == nil {
+		without := map[string]json.RawMessage{}
+		for field, value := range participant {
+			if field != "suspension" {
+				without[field] = value
+			}
+		}
+		participant = without
+	} else {
+		participant["suspension"], _ = json.Marshal(suspension)
+	}
+	participantAsBytes, _ = json.Marshal(participant)
+	return put_entity_state(stub, participantNamespace, id, participantAsBytes)
+}
+
+// ============================================================================================================================
+// check_not_suspended() - refuse if any of the participants is suspended today
+//
+// Empty ids are skipped, so optional participants can be passed as they are.
+// ============================================================================================================================
+func check_not_suspended(stub shim.ChaincodeStubInterface, ids ...string) error {
+	today, err := tx_date(stub)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if len(id) == 0 {
+			continue
+		}
+		suspension, err := get_suspension(stub, id)
+		if err != nil {
+			return err
+		}
+		if suspension == nil {
+			continue
+		}
+		effective, err := parse_date(suspension.EffectiveDate, "Effective date")
+		if err != nil {
+			return err
+		}
+		if !effective.After(today) {
+			return errors.New("Participant " + id + " is suspended since " + suspension.EffectiveDate + " - " + suspension.Reason)
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// get_suspension_events() - every suspension and reinstatement of a participant, in order
+// ============================================================================================================================
+func get_suspension_events(stub shim.ChaincodeStubInterface, id string) ([]SuspensionEvent, error) {
+	events := []SuspensionEvent{}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(suspensionEventIndex, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		aKeyValue, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var event SuspensionEvent
+		json.Unmarshal(aKeyValue.Value, &event)
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// ============================================================================================================================
+// record_suspension_event() - number the event after the participant's previous ones and log it
+// ============================================================================================================================
+func record_suspension_event(stub shim.ChaincodeStubInterface, event *SuspensionEvent) error {
+	events, err := get_suspension_events(stub, event.ParticipantId)
+	if err != nil {
+		return err
+	}
+	event.Seq = len(events) + 1
+	eventKey, err := stub.CreateCompositeKey(suspensionEventIndex, []string{event.ParticipantId, fmt.Sprintf("%06d", event.Seq)})
+	if err != nil {
+		return err
+	}
+	eventAsBytes, _ := json.Marshal(event)
+	return stub.PutState(eventKey, eventAsBytes)
+}
+
+// ============================================================================================================================
+// suspension_subject() - check a regulator can suspend or reinstate a participant
+//
+// Regulators only act on participants of their own country; retailers and brokers have none.
+// ============================================================================================================================
+func suspension_subject(stub shim.ChaincodeStubInterface, participantId string, regulatorId string) error {
+	var participant struct {
+		CountryId string `json:"countryId"`
+	}
+	user, err := get_user(stub, participantId)
+	if err != nil {
+		return err
+	}
+	if _, ok := userResources[user.Type]; !ok {
+		return errors.New("Participant " + participantId + " is not a supplier, importer, retailer or broker")
+	}
+	regulator, err := get_regulator(stub, regulatorId)
+	if err != nil {
+		return err
+	}
+	err = assert_caller(stub, regulatorId)
+	if err != nil {
+		return err
+	}
+
+	participantAsBytes, _ := get_entity_state(stub, participantNamespace, participantId)
+	json.Unmarshal(participantAsBytes, &participant)
+	if len(participant.CountryId) > 0 && participant.CountryId != regulator.CountryId {
+		return errors.New("Regulator " + regulator.Id + " regulates " + regulator.CountryId + ", not " + participant.CountryId +
+			" where " + participantId + " operates")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Suspend Participant - regulator suspends a supplier, importer, retailer or broker
+//
+// Inputs - Array of strings
+//
+//	       0      ,      1      ,            2            ,        3
+//	participant id, regulator id,          reason         , [effective date] - YYYY-MM-DD, defaults to today
+//	 "supplier1"  , "regulator1", "repeated labelling violations", "2018-07-01"
+//
+// Returns - the SuspensionEvent
+// ============================================================================================================================
+func suspend_participant(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting suspend_participant")
+
+	if len(args) != 3 && len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting participant id, regulator id, reason and optionally the effective date")
+	}
+
+	event := SuspensionEvent{
+		ParticipantId: args[0],
+		Action:        SuspensionSuspended,
+		RegulatorId:   args[1],
+		Reason:        args[2],
+		TxId:          stub.GetTxID(),
+	}
+	if len(event.Reason) == 0 {
+		return shim.Error("A suspension needs a reason")
+	}
+	today, err := tx_date(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	event.EffectiveDate = today.Format(dateLayout)
+	if len(args) == 4 {
+		effective, err := parse_date(args[3], "Effective date")
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if effective.Before(today) {
+			return shim.Error("Effective date " + args[3] + " is in the past")
+		}
+		event.EffectiveDate = args[3]
+	}
+
+	err = suspension_subject(stub, event.ParticipantId, event.RegulatorId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	current, err := get_suspension(stub, event.ParticipantId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if current != nil {
+		return shim.Error("Participant " + event.ParticipantId + " is already suspended from " + current.EffectiveDate)
+	}
+
+	err = record_suspension_event(stub, &event)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = put_suspension(stub, event.ParticipantId, &event)
+	if err != nil {
+		fmt.Println("Could not store participant")
+		return shim.Error(err.Error())
+	}
+
+	eventAsBytes, _ := json.Marshal(event)
+	fmt.Println("- end suspend_participant")
+	return shim.Success(eventAsBytes)
+}
+
+// ============================================================================================================================
+// Reinstate Participant - regulator lifts a participant's suspension, or cancels one not yet in effect
+//
+// Inputs - Array of strings
+//
+//	       0      ,      1      ,          2
+//	participant id, regulator id,        reason
+//	 "supplier1"  , "regulator1", "corrective actions verified"
+//
+// Returns - the SuspensionEvent
+// ============================================================================================================================
+func reinstate_participant(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting reinstate_participant")
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3. participant id, regulator id and reason")
+	}
+
+	event := SuspensionEvent{
+		ParticipantId: args[0],
+		Action:        SuspensionReinstated,
+		RegulatorId:   args[1],
+		Reason:        args[2],
+		TxId:          stub.GetTxID(),
+	}
+	if len(event.Reason) == 0 {
+		return shim.Error("A reinstatement needs a reason")
+	}
+	today, err := tx_date(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	event.EffectiveDate = today.Format(dateLayout)
+
+	err = suspension_subject(stub, event.ParticipantId, event.RegulatorId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	current, err := get_suspension(stub, event.ParticipantId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if current == nil {
+		return shim.Error("Participant " + event.ParticipantId + " is not suspended")
+	}
+
+	err = record_suspension_event(stub, &event)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = put_suspension(stub, event.ParticipantId, nil)
+	if err != nil {
+		fmt.Println("Could not store participant")
+		return shim.Error(err.Error())
+	}
+
+	eventAsBytes, _ := json.Marshal(event)
+	fmt.Println("- end reinstate_participant")
+	return shim.Success(eventAsBytes)
+}
+
+// ============================================================================================================================
+// Get Suspension History - a participant's current suspension and every suspension and reinstatement before it
+//
+// Inputs - Array of strings
+//
+//	       0
+//	participant id
+//	 "supplier1"
+//
+// Returns:
+//
+//	{
+//		"participantId": "supplier1",
+//		"suspended": true,
+//		"current": {"participantId": "supplier1", "seq": 3, "action": "SUSPENDED", ...},
+//		"events": [{"seq": 1, "action": "SUSPENDED", ...}, {"seq": 2, "action": "REINSTATED", ...}, ...]
+//	}
+//
+// suspended is only true once the current suspension is in effect
+// ============================================================================================================================
+func get_suspension_history(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	type SuspensionHistory struct {
+		ParticipantId string            `json:"participantId"`
+		Suspended     bool              `json:"suspended"`
+		Current       *SuspensionEvent  `json:"current"`
+		Events        []SuspensionEvent `json:"events"`
+	}
+	var err error
+	fmt.Println("starting get_suspension_history")
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting participant id")
+	}
+
+	history := SuspensionHistory{ParticipantId: args[0]}
+	history.Current, err = get_suspension(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	history.Suspended = check_not_suspended(stub, args[0]) != nil
+	history.Events, err = get_suspension_events(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	historyAsBytes, _ := json.Marshal(history)
+	fmt.Println("- end get_suspension_history")
+	return shim.Success(historyAsBytes)
+}
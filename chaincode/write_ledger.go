@@ -21,7 +21,8 @@ package main
 
 import (
 	"encoding/json"
-  // "encoding/csv"
+	// "encoding/csv"
+	"errors"
 	"fmt"
 	// "strconv"
 	"strings"
@@ -40,9 +41,11 @@ import (
 // Shows Off PutState() - writting a key/value into the ledger
 //
 // Inputs - Array of strings
-//    0   ,    1
-//   key  ,  value
-//  "abc" , "test"
+//
+//	  0   ,    1
+//	 key  ,  value
+//	"abc" , "test"
+//
 // ============================================================================================================================
 func write(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var key, value string
@@ -53,15 +56,9 @@ func write(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 		return shim.Error("Incorrect number of arguments. Expecting 2. key of the variable and value to set")
 	}
 
-	// input sanitation
-	err = sanitize_arguments(args)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-
-	key = args[0]                                   //rename for funsies
+	key = args[0] //rename for funsies
 	value = args[1]
-	err = stub.PutState(key, []byte(value))         //write the variable into the ledger
+	err = stub.PutState(key, []byte(value)) //write the variable into the ledger
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -76,16 +73,21 @@ func write(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 // Shows Off DelState() - "removing"" a key/value from the ledger
 //
 // Inputs - Array of strings
-//      0      ,         1
-//     id      ,  authed_by_company
+//
+//	 0      ,         1
+//	id      ,  authed_by_company
+//
 // "m999999999", "united marbles"
 // ============================================================================================================================
-func delete(stub shim.ChaincodeStubInterface, args []string) (pb.Response) {
+func delete(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	fmt.Println("starting delete")
 
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
 	id := args[0]
 
-	err := stub.DelState(id)                                                 //remove the key from chaincode state
+	err := stub.DelState(id) //remove the key from chaincode state
 	if err != nil {
 		return shim.Error("Failed to delete state")
 	}
@@ -97,35 +99,82 @@ func delete(stub shim.ChaincodeStubInterface, args []string) (pb.Response) {
 // ============================================================================================================================
 // Init Product - create a new product, store into chaincode state
 //
-// Shows off building a key's JSON value manually
-//
 // Inputs - Array of strings
-
-//      0      ,    1  ,     				2  ,      																			3          			 ,    4     ,     5					, 	6
-//     id      ,  loan amount ,  borrower_info , 															, state								 , interest ,  balance due	, grade
-// "m999999999", "545,000"    ,   object																				deliquent/in payment , 	3.0    , 		520,000			,  BBB
-															// credit/income verification/debt to income,
-
+//
+//	                                                         0
+//	                                                product (JSON)
+//	{"id": "product1", "quantity": "12.5", "countryId": "US", "unit": "kg", "lotNumber": "L2018-114",
+//	 "productionDate": "2018-06-01", "bestBefore": "2018-09-01", "category": "shellfish", "gtin": "(01)09506000134352"}
+//
+// unit is one of kg, lb, litres, units or cases and defaults to units. Lot number and dates are optional as a group.
+// A GTIN is stored as GTIN-14 and a description can be up to 512 characters.
+// See get_schema for the whole schema.
+//
+// The positional arguments are still accepted
+//
+//	    0      ,    1     ,     2     ,        3       ,      4     ,       5         ,      6      ,     7
+//	   id      , quantity , country id, unit (optional), lot number , production date , best before , category
+//	"product1" ,  "12.5"  ,    "US"   ,      "kg"      , "L2018-114",  "2018-06-01"   , "2018-09-01", "shellfish"
+//
+// category is optional and always last, after the unit if there are no dates: "product1", "12.5", "US", "kg", "shellfish"
 // ============================================================================================================================
-func init_product(stub shim.ChaincodeStubInterface, args []string) (pb.Response) {
+func init_product(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var err error
 	fmt.Println("starting init_product")
+
+	var document ProductDocument
+	err = parse_document("init_product", args, product_document, &document)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	var product Product
-	product.Id = args[0]
-	product.Quantity =  args[1]
-	product.CountryId = args[2]
+	product.Id = document.Id
+	product.Unit = defaultUnit
+	if len(document.Unit) > 0 {
+		product.Unit = document.Unit
+	}
+	product.Category = strings.ToLower(document.Category)
+	product.CountryId = document.CountryId
+	product.LotNumber = document.LotNumber
+	product.ProductionDate = document.ProductionDate
+	product.BestBefore = document.BestBefore
+	product.Gtin, _ = normalize_gtin(document.Gtin)
+	product.Description = document.Description
+
+	var problems []string
+	quantity, err := parse_quantity(document.Quantity, product.Unit)
+	if err != nil {
+		problems = append(problems, "quantity: "+err.Error())
+	} else {
+		product.Quantity = format_decimal(quantity)
+	}
+	if len(product.LotNumber) > 0 {
+		dateProblems, err := validate_product_dates(stub, product)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		problems = append(problems, dateProblems...)
+	}
+	if len(problems) > 0 {
+		return shim.Error(document_error("init_product", problems).Error())
+	}
 	// check if product already exists
-	// TODO, uncomment
-	// _, err = get_product(stub, product.Id)
-	// if err == nil {
-	// 	fmt.Println("This product already exists - " + product.Id)
-	// 	return shim.Error("This product already exists - " + product.Id)
-	// }
+	_, err = get_product(stub, product.Id)
+	if err == nil {
+		fmt.Println("This product already exists - " + product.Id)
+		return shim.Error("This product already exists - " + product.Id)
+	}
+	// the supplier creating the product is the only one who can list it
+	product.Supplier, err = get_caller_id(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	//store product
-	productAsBytes, _ := json.Marshal(product)                         //convert to array of bytes
+	productAsBytes, _ := json.Marshal(product) //convert to array of bytes
 	fmt.Println("writing product to state")
 	fmt.Println(string(productAsBytes))
-	err = stub.PutState(product.Id, productAsBytes)                    //store owner by its Id
+	err = put_product(stub, product)
 	if err != nil {
 		fmt.Println("Could not store product")
 		return shim.Error(err.Error())
@@ -135,163 +184,467 @@ func init_product(stub shim.ChaincodeStubInterface, args []string) (pb.Response)
 	return shim.Success(nil)
 }
 
+// product_document() - init_product's positional arguments as its document
+func product_document(args []string) (map[string]interface{}, error) {
+	if len(args) != 3 && len(args) != 4 && len(args) != 5 && len(args) != 7 && len(args) != 8 {
+		return nil, errors.New("Incorrect number of arguments. Expecting a product document, or id, quantity, country id, an optional unit, optionally lot number, production date and best before and an optional category")
+	}
+	document := map[string]interface{}{"id": args[0], "quantity": args[1], "countryId": args[2]}
+	if len(args) >= 4 {
+		document["unit"] = strings.ToLower(args[3])
+	}
+	if len(args) >= 7 {
+		document["lotNumber"] = args[4]
+		document["productionDate"] = args[5]
+		document["bestBefore"] = args[6]
+	}
+	if len(args) == 5 || len(args) == 8 {
+		document["category"] = args[len(args)-1]
+	}
+	return document, nil
+}
 
 // update_product
 
-
 // generate_securities
 
-
-
-
-
-
-
 // pool_product (product)
 // underwriting info gives grade
 // grade determines pool
 // pool determines return, but also likliehood of failure/delinquency
 
-
 // ============================================================================================================================
-// Init Owner - create a new owner aka end user, store into chaincode state
+// Init User - register the caller as a supplier, importer, retailer or customs broker
 //
-// Shows off building key's value from GoLang Structure
+// The type comes from the food.role attribute of the caller's certificate and a supplier's country from food.country,
+// see roles.go. The type and country can still be given but must match the certificate.
 //
 // Inputs - Array of Strings
-//           0     ,     1   ,   2
-//      owner id   , username, company
-// "o9999999999999",     bob", "united marbles"
+//
+//	                                                         0
+//	                                                    user (JSON)
+//	{"id": "supplier1", "type": "supplier", "countryId": "US", "orgId": "org1", "profile": {"legalName": "Acme Foods Inc."}}
+//
+// Suppliers give their org id and brokers their customs broker license number instead
+//
+//	{"id": "broker1", "licenseNumber": "CB-20417"}
+//
+// The profile is optional and takes the fields update_user does. See get_schema for the whole schema.
+//
+// The positional arguments are still accepted
+//
+//	      0     ,     1      ,     2     ,    3
+//	   user id  , [userType] , [country] , org id (suppliers only)
+//	"supplier1" , "supplier" ,    "US"   , "org1"
+//	 "broker1"  ,  "broker"  ,  "CB-20417"
+//
 // ============================================================================================================================
 func init_user(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var err error
 	fmt.Println("starting init_user")
 
-	//input sanitation
-	err = sanitize_arguments(args)
+	caller, err := read_caller_role(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var document UserDocument
+	err = parse_document("init_user", args, user_document(caller.Role), &document)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	id := document.Id
+
+	// participants register themselves, binding their certificate
+	identity, err := bind_caller(stub, id)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	userType := caller.Role
+	if _, ok := userResources[userType]; !ok {
+		return shim.Error("Caller " + id + " has no supplier, importer, retailer or broker role")
+	}
+	if len(document.Type) > 0 && document.Type != userType {
+		return shim.Error("User type " + document.Type + " does not match the caller's certificate role " + userType)
+	}
 
-  // TODO, should probably allow JSON object as third arg
-	// user.ObjectType = "product_user"
-  id := args[0]
-  userType := args[1]
+	// what each role registers with
+	var problems []string
+	if userType == RoleSupplier && len(document.OrgId) == 0 {
+		problems = append(problems, "orgId: required for suppliers")
+	}
+	if userType != RoleSupplier && len(document.OrgId) > 0 {
+		problems = append(problems, "orgId: only suppliers have an org id")
+	}
+	if userType != RoleSupplier && len(document.CountryId) > 0 {
+		problems = append(problems, "countryId: only suppliers give their country, it comes from the certificate")
+	}
+	if userType == RoleBroker && len(document.LicenseNumber) == 0 {
+		problems = append(problems, "licenseNumber: required for customs brokers")
+	}
+	if userType != RoleBroker && len(document.LicenseNumber) > 0 {
+		problems = append(problems, "licenseNumber: only customs brokers have a license number")
+	}
+	if document.Profile != nil {
+		for _, problem := range profile_problems(*document.Profile) {
+			problems = append(problems, "profile."+problem)
+		}
+	}
+	if len(problems) > 0 {
+		return shim.Error(document_error("init_user", problems).Error())
+	}
 
-  var user User
+	var user User
 	user.Id = id
-  user.Type = userType
-
-  // userType := "supplier"
-  // switch user.Type := {
-
-  // TODO, remove userType arg
-  // if strings.Contains(id, "supplier") {
-  //
-  // } else if strings.Contains(id, "importer") {
-  //
-  // } else if strings.Contains(id, "retailer") {
-  //
-  // }
-  switch userType {
-    case "supplier":
-      var supplier Supplier
-      supplier.User = user
-      supplier.countryId = args[2]
-      supplier.orgId = args[3]
-      supplierAsBytes, _ := json.Marshal(supplier)                         //convert to array of bytes
-    	err = stub.PutState(id, supplierAsBytes)                    //store owner by its Id
-    	if err != nil {
-    		fmt.Println("Could not store supplier")
-    		return shim.Error(err.Error())
-    	}
-    case "importer":
-      var importer Importer
-      importer.User = user
-      importerAsBytes, _ := json.Marshal(importer)                         //convert to array of bytes
-      err = stub.PutState(id, importerAsBytes)                    //store owner by its Id
-    	if err != nil {
-    		fmt.Println("Could not store importer")
-    		return shim.Error(err.Error())
-    	}
-    case "retailer":
-      var retailer Retailer
-      retailer.User = user
-      retailer.Products = nil //[]Product
-      retailerAsBytes, _ := json.Marshal(retailer)                         //convert to array of bytes
-      err = stub.PutState(id, retailerAsBytes)                    //store owner by its Id
-    	if err != nil {
-    		fmt.Println("Could not store retailer")
-    		return shim.Error(err.Error())
-    	}
-  }
+	user.Type = userType
+	user.Identity = identity
+	// re-registering does not lift a suspension or lose the profile
+	user.Suspension, err = get_suspension(stub, id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	existing, err := get_user(stub, id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(existing.Id) > 0 && existing.Type != userType {
+		return shim.Error("Participant " + id + " is already registered as " + existing.Type)
+	}
+	user.Profile = existing.Profile
+	if document.Profile != nil {
+		user.Profile = *document.Profile
+	}
+
+	switch userType {
+	case RoleSupplier:
+		country := caller.Country
+		if len(document.CountryId) > 0 {
+			if len(country) > 0 && document.CountryId != country {
+				return shim.Error("Country " + document.CountryId + " does not match the caller's certificate country " + country)
+			}
+			country = document.CountryId
+		}
+		if len(country) == 0 {
+			return shim.Error("Caller " + id + " has no " + countryAttribute + " attribute")
+		}
+		var supplier Supplier
+		supplier.User = user
+		supplier.CountryId = country
+		supplier.OrgId = document.OrgId
+		err = put_participant(stub, supplier)
+		if err != nil {
+			fmt.Println("Could not store supplier")
+			return shim.Error(err.Error())
+		}
+	case RoleImporter:
+		if len(caller.Country) == 0 {
+			return shim.Error("Caller " + id + " has no " + countryAttribute + " attribute")
+		}
+		var importer Importer
+		importer.User = user
+		importer.CountryId = caller.Country
+		err = put_participant(stub, importer)
+		if err != nil {
+			fmt.Println("Could not store importer")
+			return shim.Error(err.Error())
+		}
+	case RoleRetailer:
+		// re-registering keeps the stock held and its movement sequence
+		retailer, err := get_retailer(stub, id)
+		if err != nil {
+			retailer = Retailer{}
+		}
+		retailer.User = user
+		err = put_participant(stub, retailer)
+		if err != nil {
+			fmt.Println("Could not store retailer")
+			return shim.Error(err.Error())
+		}
+	case RoleBroker:
+		var broker Broker
+		broker.User = user
+		broker.LicenseNumber = document.LicenseNumber
+		err = put_participant(stub, broker)
+		if err != nil {
+			fmt.Println("Could not store broker")
+			return shim.Error(err.Error())
+		}
+	}
 	fmt.Println("- end init_user")
 	return shim.Success(nil)
 }
 
+// user_document() - init_user's positional arguments as its document, for a caller with the given role
+func user_document(role string) func([]string) (map[string]interface{}, error) {
+	return func(args []string) (map[string]interface{}, error) {
+		if len(args) < 1 {
+			return nil, errors.New("Incorrect number of arguments. Expecting a user document or user id")
+		}
+		document := map[string]interface{}{"id": args[0]}
+		rest := args[1:]
+		if len(rest) > 0 && is_role(rest[0]) {
+			document["type"] = rest[0]
+			rest = rest[1:]
+		}
+		switch role {
+		case RoleSupplier:
+			if len(rest) > 2 {
+				return nil, errors.New("Incorrect number of arguments. Expecting supplier id, an optional country and org id")
+			}
+			if len(rest) == 2 {
+				document["countryId"] = rest[0]
+				rest = rest[1:]
+			}
+			if len(rest) == 1 {
+				document["orgId"] = rest[0]
+			}
+		case RoleBroker:
+			if len(rest) > 1 {
+				return nil, errors.New("Incorrect number of arguments. Expecting broker id and license number")
+			}
+			if len(rest) == 1 {
+				document["licenseNumber"] = rest[0]
+			}
+		}
+		return document, nil
+	}
+}
 
-
+// ============================================================================================================================
+// Init Product Listing - supplier lists products for sale to importers
+//
+// Inputs - Array of Strings
+//
+//	                                                  0
+//	                                           listing (JSON)
+//	{"id": "productlistingcontract1", "supplierId": "supplier1", "productIds": ["product1", "product2"]}
+//
+// The positional arguments are still accepted
+//
+//	           0            ,      1      ,     2     ,     3      , ...
+//	       listing id       , supplier id , product id, product id , ...
+//	"productlistingcontract1", "supplier1" , "product1", "product2"
+//
+// ============================================================================================================================
 func init_product_listing(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var err error
 	fmt.Println("starting init_product_listing")
 
-	//input sanitation
-	err = sanitize_arguments(args)
+	var document ProductListingDocument
+	err = parse_document("init_product_listing", args, product_listing_document, &document)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	// user.ObjectType = "product_user"
-  product_listing_id := args[0]
-  supplier_id := args[1]
-  // product_ids := args[2] // Expecting JSON array of product ids. TODO, csv would probably be easier?
+	product_listing_id := document.Id
+	supplier_id := document.SupplierId
 
-  productListing := ProductListingContract{}
-  productListing.Id = product_listing_id
-  productListing.Status = "INITIALREQUEST"
-  productListing.Owner = supplier_id
-  productListing.Supplier = supplier_id
-  productListing.OwnerType = "Supplier"
+	_, err = get_supplier(stub, supplier_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = assert_caller(stub, supplier_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = check_not_suspended(stub, supplier_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// a listing only starts once, re-initialising it would skip the transition table
+	_, err = get_product_listing(stub, product_listing_id)
+	if err == nil {
+		return shim.Error("This listing already exists - " + product_listing_id)
+	}
+	// check_products() takes a listing or a consignment id, so they must not share one
+	_, err = get_consignment(stub, product_listing_id)
+	if err == nil {
+		return shim.Error("This id is already used by a consignment - " + product_listing_id)
+	}
 
-  numProducts := len(args) - 2
-  var products = make([]string, numProducts)
-  // all array elements after first 2 are parsed as product ids
-  for i := 2; i < len(args); i++ {
-    products[i - 2] = args[i]
-  }
-  productListing.Products = products //csv.NewReader(product_ids) //json.Unmarshal(product_ids)
+	productListing := ProductListingContract{}
+	productListing.Id = product_listing_id
+	productListing.Status = listingInitialStatus
+	productListing.Owner = supplier_id
+	productListing.Supplier = supplier_id
+	productListing.OwnerType = "Supplier"
+	productListing.Products = document.ProductIds
 
-  // TODO? update product location to same as supplier
-  // supplierAsBytes, err := stub.GetState(supplier_id)
-  // supplier := Supplier{}
+	// a supplier only lists its own products
+	err = check_product_supplier(stub, productListing.Products, supplier_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// a product is only in one listing at a time, or it would be received and counted twice
+	err = check_not_listed(stub, productListing.Products)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// expired goods cannot be listed
+	err = check_not_expired(stub, productListing.Products)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// TODO? update product location to same as supplier
+	// supplierAsBytes, err := stub.GetState(supplier_id)
+	// supplier := Supplier{}
 	// err = json.Unmarshal(supplierAsBytes, &supplier)           //un stringify it aka JSON.parse()
 	// if err != nil {
 	// 	return shim.Error("Error loading supplier")
 	// }
-  productListingAsBytes, _ := json.Marshal(productListing)                         //convert to array of bytes
-  err = stub.PutState(product_listing_id, productListingAsBytes)                    //store owner by its Id
+	err = put_product_listing(stub, productListing)
 	if err != nil {
 		fmt.Println("Could not store product listing")
 		return shim.Error(err.Error())
 	}
+	for _, productId := range productListing.Products {
+		product, err := get_product(stub, productId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		product.ListingId = productListing.Id
+		err = put_product(stub, product)
+		if err != nil {
+			fmt.Println("Could not store product")
+			return shim.Error(err.Error())
+		}
+	}
 	fmt.Println("- end init_product_listing")
 	return shim.Success(nil)
 }
 
+// ============================================================================================================================
+// check_not_listed() - refuse products already in a listing that is still open
+//
+// A listing stays open until its goods are destroyed or re-exported. A split listing's products are in its children.
+// ============================================================================================================================
+func check_not_listed(stub shim.ChaincodeStubInterface, productIds []string) error {
+	var listed []string
+	for _, productId := range productIds {
+		product, err := get_product(stub, productId)
+		if err != nil {
+			return err
+		}
+		if len(product.ListingId) == 0 {
+			continue
+		}
+		listing, err := get_product_listing(stub, product.ListingId)
+		if err != nil {
+			return err
+		}
+		if listing.Status != StatusDestroyed && listing.Status != StatusReExported {
+			listed = append(listed, productId+" (listing "+listing.Id+")")
+		}
+	}
+	if len(listed) > 0 {
+		return errors.New("Products are already listed - " + strings.Join(listed, ", "))
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// check_product_supplier() - refuse products that supplier id did not create
+//
+// Products stored before the creating supplier was recorded have no supplier and cannot be listed.
+// ============================================================================================================================
+func check_product_supplier(stub shim.ChaincodeStubInterface, productIds []string, supplierId string) error {
+	var others []string
+	for _, productId := range productIds {
+		product, err := get_product(stub, productId)
+		if err != nil {
+			return err
+		}
+		if product.Supplier != supplierId {
+			others = append(others, productId)
+		}
+	}
+	if len(others) > 0 {
+		return errors.New("Products were not created by supplier " + supplierId + " - " + strings.Join(others, ", "))
+	}
+	return nil
+}
+
+// product_listing_document() - init_product_listing's positional arguments as its document
+func product_listing_document(args []string) (map[string]interface{}, error) {
+	if len(args) < 3 {
+		return nil, errors.New("Incorrect number of arguments. Expecting a listing document, or listing id, supplier id and product ids")
+	}
+	var products []interface{}
+	for _, productId := range args[2:] {
+		products = append(products, productId)
+	}
+	return map[string]interface{}{"id": args[0], "supplierId": args[1], "productIds": products}, nil
+}
+
+// ============================================================================================================================
+// Init Regulator - register the caller as a regulator, the caller's certificate must carry food.role=regulator
+//
+// Inputs - Array of Strings
+//
+//	                                        0
+//	                                 regulator (JSON)
+//	{"id": "regulator1", "countryId": "US", "profile": {"legalName": "Food and Drug Administration"}}
+//
+// The country defaults to the certificate's food.country and the profile is optional. See get_schema for the whole
+// schema.
+//
+// The positional arguments are still accepted
+//
+//	      0      ,     1
+//	regulator id , [country]
+//	"regulator1" ,   "US"
+//
+// ============================================================================================================================
 func init_regulator(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var err error
 	fmt.Println("starting init_regulator")
 
-	//input sanitation
-	err = sanitize_arguments(args)
+	var document RegulatorDocument
+	err = parse_document("init_regulator", args, regulator_document, &document)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if document.Profile != nil {
+		var problems []string
+		for _, problem := range profile_problems(*document.Profile) {
+			problems = append(problems, "profile."+problem)
+		}
+		if len(problems) > 0 {
+			return shim.Error(document_error("init_regulator", problems).Error())
+		}
+	}
+	identity, err := bind_caller(stub, document.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	caller, err := read_caller_role(stub)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-  // regulator_id := args[0]
-  regulator := Regulator{}
-  regulator.Id = args[0]
-  regulator.countryId = args[1]
-  regulatorAsBytes, _ := json.Marshal(regulator)                         //convert to array of bytes
-  err = stub.PutState(regulator.Id, regulatorAsBytes)                    //store owner by its Id
+	country := caller.Country
+	if len(document.CountryId) > 0 {
+		if len(country) > 0 && document.CountryId != country {
+			return shim.Error("Country " + document.CountryId + " does not match the caller's certificate country " + country)
+		}
+		country = document.CountryId
+	}
+	if len(country) == 0 {
+		return shim.Error("Caller " + document.Id + " has no " + countryAttribute + " attribute")
+	}
+	// exemptions an older version kept on the regulator become its country's, before the record is rewritten without them
+	err = migrate_regulator_exemptions(stub, document.Id, country)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// re-registering keeps the profile unless a new one is given
+	regulator, _ := get_regulator(stub, document.Id)
+	if document.Profile != nil {
+		regulator.Profile = *document.Profile
+	}
+	regulator.Id = document.Id
+	regulator.Type = RoleRegulator
+	regulator.CountryId = country
+	regulator.Identity = identity
+	err = put_participant(stub, regulator)
 	if err != nil {
 		fmt.Println("Could not store regulator")
 		return shim.Error(err.Error())
@@ -300,161 +653,273 @@ func init_regulator(stub shim.ChaincodeStubInterface, args []string) pb.Response
 	return shim.Success(nil)
 }
 
+// regulator_document() - init_regulator's positional arguments as its document
+func regulator_document(args []string) (map[string]interface{}, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errors.New("Incorrect number of arguments. Expecting a regulator document, or regulator id and an optional country")
+	}
+	document := map[string]interface{}{"id": args[0]}
+	if len(args) == 2 {
+		document["countryId"] = args[1]
+	}
+	return document, nil
+}
+
 func transfer_product_listing(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-  var err error
+	var err error
 	fmt.Println("-starting transfer_product_listing")
-  //input sanitation
-	err = sanitize_arguments(args)
-	if err != nil {
-		return shim.Error(err.Error())
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
 	}
-  product_listing_id := args[0]
-  new_owner_id := args[1]
-  // user_type := args[1]
-  // user_id := args[1]
-  // retailer_id := args[2]
+	product_listing_id := args[0]
+	new_owner_id := args[1]
+	// user_type := args[1]
+	// user_id := args[1]
+	// retailer_id := args[2]
 
-  productListingAsBytes, err := stub.GetState(product_listing_id)
-  productListing := ProductListingContract{}
-	err = json.Unmarshal(productListingAsBytes, &productListing)           //un stringify it aka JSON.parse()
+	productListingAsBytes, err := get_entity_state(stub, listingNamespace, product_listing_id)
+	if err != nil {
+		return shim.Error("Failed to get product listing - " + product_listing_id)
+	}
+	productListing := ProductListingContract{}
+	err = json.Unmarshal(productListingAsBytes, &productListing) //un stringify it aka JSON.parse()
 	if err != nil {
 		fmt.Println(string(productListingAsBytes))
 		return shim.Error(err.Error())
 	}
-  productListing.Owner = new_owner_id
-  if (strings.ToLower(productListing.OwnerType) == "supplier") {
-    productListing.OwnerType = "Importer"
-    productListing.Status = "EXEMPTCHECKREQ"
-    productListing.Owner = new_owner_id
-
-  } else if ( strings.ToLower(productListing.OwnerType) == "importer" ) {
-    productListing.OwnerType = "Retailer"
-    if ( productListing.Status == "EXEMPTCHECKREQ" ){
-      return shim.Error("Products in listing need to be checked by regulator.")
-    } else if ( productListing.Status == "HAZARDANALYSISCHECKREQ" ){
-      return shim.Error("Products cannot be transferred as they've been flagged by regulator.")
-    }
-    retailerAsBytes, err := stub.GetState(new_owner_id)
-    retailer := Retailer{}
-  	err = json.Unmarshal(retailerAsBytes, &retailer)           //un stringify it aka JSON.parse()
-  	if err != nil {
-  		fmt.Println(string(retailerAsBytes))
-  		return shim.Error(err.Error())
-  	}
-    // _, products := json.Marshal(productListing.Products)
-    for _, product := range productListing.Products {
-      retailer.Products = append(retailer.Products, product)
-    }
-    retailerAsBytes, _ = json.Marshal(retailer)           //convert to array of bytes
-    err = stub.PutState(new_owner_id, retailerAsBytes)     //rewrite the marble with id as key
-    if err != nil {
-      return shim.Error(err.Error())
-    }
-  } else {
-      return shim.Error("Invalid user type provided.")
-  }
-  productListingAsBytes, _ = json.Marshal(productListing)                         //convert to array of bytes
-  err = stub.PutState(product_listing_id, productListingAsBytes)                    //store owner by its Id
+	// only the current holder, or its broker, can hand the listing on
+	delegatedAction, err := act_for(stub, productListing.Owner, "transfer_product_listing")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	productListing.DelegatedAction = delegatedAction
+	err = check_not_suspended(stub, productListing.Owner, new_owner_id, productListing.Supplier)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = check_not_expired(stub, productListing.Products)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	productListing.Owner = new_owner_id
+	if strings.ToLower(productListing.OwnerType) == "supplier" {
+		err = transition_listing(&productListing, ActionTransferToImporter, StatusExemptCheckReq)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		productListing.OwnerType = "Importer"
+		productListing.Owner = new_owner_id
+		// the importer's country decides which regulators can check the listing
+		importer, err := get_importer(stub, new_owner_id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if len(importer.CountryId) == 0 {
+			return shim.Error("Importer " + importer.User.Id + " has no country, register it again with init_user")
+		}
+		productListing.DestinationCountry = importer.CountryId
+
+	} else if strings.ToLower(productListing.OwnerType) == "importer" {
+		// cleared listings keep their status once delivered
+		err = transition_listing(&productListing, ActionTransferToRetailer, productListing.Status)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		productListing.OwnerType = "Retailer"
+		retailer, err := get_retailer(stub, new_owner_id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		// _, products := json.Marshal(productListing.Products)
+		for _, product := range productListing.Products {
+			quantity, unit, err := listing_product_quantity(stub, productListing, product)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			err = record_stock_movement(stub, &retailer, product, StockReceived, quantity, unit, productListing.Id)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+		err = put_participant(stub, retailer)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	} else {
+		return shim.Error("Invalid user type provided.")
+	}
+	err = put_product_listing(stub, productListing)
 	if err != nil {
 		fmt.Println("Could not store product listing")
 		return shim.Error(err.Error())
 	}
-  fmt.Println("- end transfer_product_listing")
+	fmt.Println("- end transfer_product_listing")
 	return shim.Success(nil)
 }
 
+// ============================================================================================================================
+// Update Exempted List - maintain the org or product ids exempted from the hazard analysis check in the regulator's
+// country, see jurisdiction.go
+//
+// Inputs - Array of strings
+//
+//	     0      ,       1        ,            2             ,  3 ...
+//	regulator id, exempted type  ,          mode            ,  ids
+//	            , "org"/"product", "add"/"remove"/"replace" ,
+//
+// "regulator1" ,     "org"      ,          "add"           , "org1", "org2"
+//
+// add ignores ids that are already exempted, remove ignores ids that are not.
+// replace with no ids clears the list.
+//
+// Returns - the updated Jurisdiction
+// ============================================================================================================================
 func update_exempted_list(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-  fmt.Println("- start update_exempted_list")
-  // ["regulator1", "org", "org1", "org2"..]
-  // add list of exempted orgs or products to regulator
-  regulator_id := args[0]
-  exempted_type := args[1]
-  // all remaining args are list of ids
+	var err error
+	fmt.Println("- start update_exempted_list")
+
+	if len(args) < 3 {
+		return shim.Error("Incorrect number of arguments. Expecting regulator id, exempted type, mode and a list of ids")
+	}
 
+	regulator_id := args[0]
+	exempted_type := args[1]
+	mode := args[2]
+	ids := dedupe_strings(args[3:]) // all remaining args are list of ids
 
-  regulatorAsBytes, err := stub.GetState(regulator_id)
-  regulator := Regulator{}
-	err = json.Unmarshal(regulatorAsBytes, &regulator)           //un stringify it aka JSON.parse()
+	if exempted_type != "org" && exempted_type != "product" {
+		return shim.Error("Invalid exempted type " + exempted_type + ". Expecting \"org\" or \"product\"")
+	}
+	if mode != "add" && mode != "remove" && mode != "replace" {
+		return shim.Error("Invalid mode " + mode + ". Expecting \"add\", \"remove\" or \"replace\"")
+	}
+	if mode != "replace" && len(ids) == 0 {
+		return shim.Error("Expecting at least one id to " + mode)
+	}
+
+	regulator, err := get_regulator(stub, regulator_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = assert_caller(stub, regulator_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(regulator.CountryId) == 0 {
+		return shim.Error("Regulator " + regulator.Id + " has no country, register it again with init_regulator")
+	}
+	jurisdiction, err := get_jurisdiction(stub, regulator.CountryId)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-  numIds := len(args) - 2
-  ids := make([]string, numIds)
-  // all array elements after first 2 are parsed as product ids
-  for i := 2; i < len(args); i++ {
-    ids[i - 2] = args[i]
-  }
+	exempted := jurisdiction.ExemptedOrgIds
+	if exempted_type == "product" {
+		exempted = jurisdiction.ExemptedProductIds
+	}
+
+	switch mode {
+	case "add":
+		for _, id := range ids {
+			if !contains_string(exempted, id) {
+				exempted = append(exempted, id)
+			}
+		}
+	case "remove":
+		var kept []string
+		for _, id := range exempted {
+			if !contains_string(ids, id) {
+				kept = append(kept, id)
+			}
+		}
+		exempted = kept
+	case "replace":
+		exempted = ids
+	}
 
-  // TODO, should probably append list
-  if (exempted_type == "org") {
-    regulator.ExemptedOrgIds = ids
-  } else if (exempted_type == "product") {
-    regulator.ExemptedProductIds = ids
-  }
+	if exempted == nil {
+		exempted = []string{}
+	}
+	if exempted_type == "org" {
+		jurisdiction.ExemptedOrgIds = exempted
+	} else {
+		jurisdiction.ExemptedProductIds = exempted
+	}
 
-  regulatorAsBytes, _ = json.Marshal(regulator)                         //convert to array of bytes
-  err = stub.PutState(regulator_id, regulatorAsBytes)                    //store owner by its Id
+	jurisdictionAsBytes, err := put_jurisdiction(stub, jurisdiction)
 	if err != nil {
-		fmt.Println("Could not store regulator")
+		fmt.Println("Could not store jurisdiction")
 		return shim.Error(err.Error())
 	}
-  fmt.Println("- end update_exempted_list")
-	return shim.Success(nil)
-
+	fmt.Println("- end update_exempted_list")
+	return shim.Success(jurisdictionAsBytes)
 }
 
+// ============================================================================================================================
+// Check Products - regulator's exempt check on a listing, or on a consignment of listings, held by an importer
+//
+// Inputs - Array of strings
+//
+//	           0                 ,      1
+//	listing or consignment id    ,  regulator id
+//
+// "productlistingcontract1"           , "regulator1"
+//
+// Returns - the ExemptionCheck, listing which products were and were not exempt. For a consignment a
+//
+//	ConsignmentCheck holding the ExemptionCheck of every listing in it
+//
+// ============================================================================================================================
 func check_products(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-  product_listing_id := args[0]
-  regulator_id := args[1]
+	var err error
+	fmt.Println("- start check_products")
 
-  productListingAsBytes, err := stub.GetState(product_listing_id)
-  productListing := ProductListingContract{}
-	err = json.Unmarshal(productListingAsBytes, &productListing)           //un stringify it aka JSON.parse()
-	if err != nil {
-		return shim.Error(err.Error())
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2. listing id and regulator id")
 	}
 
-  supplierAsBytes, err := stub.GetState(productListing.Supplier)
-  supplier := Supplier{}
-	err = json.Unmarshal(supplierAsBytes, &supplier)           //un stringify it aka JSON.parse()
+	product_listing_id := args[0]
+	regulator_id := args[1]
+
+	regulator, err := get_regulator(stub, regulator_id)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-
-  regulatorAsBytes, err := stub.GetState(regulator_id)
-  regulator := Regulator{}
-	err = json.Unmarshal(regulatorAsBytes, &regulator)           //un stringify it aka JSON.parse()
+	err = assert_caller(stub, regulator_id)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-  if (productListing.Status != "EXEMPTCHECKREQ" && productListing.Status != "HAZARDANALYSISCHECKREQ"){
-    return shim.Error("Invalid state, listing cannot be checked");
-  }
+	consignment, err := get_consignment(stub, product_listing_id)
+	if err == nil {
+		return check_consignment(stub, consignment, regulator)
+	}
 
-  check := true
-  if (productListing.Status=="EXEMPTCHECKREQ"){
-    // check if the supplier org is exempted by regulator
+	productListing, err := get_product_listing(stub, product_listing_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(productListing.ConsignmentId) > 0 && productListing.Status == StatusExemptCheckReq {
+		return shim.Error("Listing " + productListing.Id + " is part of consignment " + productListing.ConsignmentId + ", check the consignment instead")
+	}
 
-    for _, orgId := range regulator.ExemptedOrgIds {
-      if ( supplier.orgId == orgId ) {
-        check = false
-      }
-    }
-  }
+	// a listing flagged for hazard analysis is only cleared through approve_hazard_analysis()
+	check, err := check_listing(stub, productListing, regulator)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = apply_check(&productListing, check.Cleared, check.SignOff)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	check.Status = productListing.Status
 
-  if (check) {
-    productListing.Status="CHECKCOMPLETED"
-  } else {
-    productListing.Status="HAZARDANALYSISCHECKREQ"
-  }
+	err = put_product_listing(stub, productListing)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
-  productListingAsBytes, _ = json.Marshal(productListing)           //convert to array of bytes
-  err = stub.PutState(product_listing_id, productListingAsBytes)     //rewrite the marble with id as key
-  if err != nil {
-    return shim.Error(err.Error())
-  }
-  fmt.Println("- end check_products")
-	return shim.Success(nil)
+	checkAsBytes, _ := json.Marshal(check)
+	fmt.Println("- end check_products")
+	return shim.Success(checkAsBytes)
 }
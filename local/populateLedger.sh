@@ -1,4 +1,6 @@
 # peer calls need -o and -C flag when using basic network
+# each call must be signed by the participant it acts for (the certificate common name is the participant id),
+# point CORE_PEER_MSPCONFIGPATH at that participant's msp before the calls made on its behalf
 peer chaincode invoke -n food -c '{"Args":["init_user", "retailer1", "retailer"]}' -C mychannel -o orderer.example.com:7050
 sleep 2
 peer chaincode invoke -n food -c '{"Args":["init_user", "supplier1", "supplier", "US", "org1"]}' -C mychannel -o orderer.example.com:7050
@@ -17,14 +19,16 @@ peer chaincode invoke -n food -c '{"Args":["init_product_listing", "productlisti
 sleep 2
 peer chaincode invoke -n food -c '{"Args":["transfer_product_listing", "productlistingcontract1", "importer1"]}'  -C mychannel -o orderer.example.com:7050
 sleep 2
-peer chaincode invoke -n food -c '{"Args":["read", "productlistingcontract1"]}' -C mychannel -o orderer.example.com:7050
+peer chaincode invoke -n food -c '{"Args":["read", "listing", "productlistingcontract1"]}' -C mychannel -o orderer.example.com:7050
+sleep 2
+peer chaincode invoke -n food -c '{"Args":["update_exempted_list", "regulator1", "org", "add", "org1"]}'  -C mychannel -o orderer.example.com:7050
 sleep 2
 peer chaincode invoke -n food -c '{"Args":["check_products", "productlistingcontract1", "regulator1"]}'  -C mychannel -o orderer.example.com:7050
 sleep 2
-peer chaincode invoke -n food -c '{"Args":["read", "productlistingcontract1"]}' -C mychannel -o orderer.example.com:7050
+peer chaincode invoke -n food -c '{"Args":["read", "listing", "productlistingcontract1"]}' -C mychannel -o orderer.example.com:7050
 sleep 2
 peer chaincode invoke -n food -c '{"Args":["transfer_product_listing", "productlistingcontract1", "retailer1"]}'  -C mychannel -o orderer.example.com:7050
 sleep 2
-peer chaincode invoke -n food -c '{"Args":["read", "productlistingcontract1"]}' -C mychannel -o orderer.example.com:7050
+peer chaincode invoke -n food -c '{"Args":["read", "listing", "productlistingcontract1"]}' -C mychannel -o orderer.example.com:7050
 sleep 2
-peer chaincode invoke -n food -c '{"Args":["read", "retailer1"]}' -C mychannel -o orderer.example.com:7050
+peer chaincode invoke -n food -c '{"Args":["read", "participant", "retailer1"]}' -C mychannel -o orderer.example.com:7050
@@ -16,6 +16,19 @@ var util = require('util');
 var os = require('os');
 
 //
+// node registerUser.js [enrollment id] [food.role] [food.country]
+// the enrollment id is the participant id the chaincode sees, food.role and food.country go into the certificate
+var enrollment_id = process.argv[2] || 'user1';
+var food_role = process.argv[3];
+var food_country = process.argv[4];
+var attrs = [];
+if (food_role) {
+    attrs.push({name: 'food.role', value: food_role, ecert: true});
+}
+if (food_country) {
+    attrs.push({name: 'food.country', value: food_country, ecert: true});
+}
+
 var fabric_client = new Fabric_Client();
 var fabric_ca_client = null;
 var admin_user = null;
@@ -53,16 +66,16 @@ Fabric_Client.newDefaultKeyValueStore({ path: store_path
 
     // at this point we should have the admin user
     // first need to register the user with the CA server
-    return fabric_ca_client.register({enrollmentID: 'user1', affiliation: 'org1.department1',role: 'client'}, admin_user);
+    return fabric_ca_client.register({enrollmentID: enrollment_id, affiliation: 'org1.department1', role: 'client', attrs: attrs}, admin_user);
 }).then((secret) => {
     // next we need to enroll the user with CA server
-    console.log('Successfully registered user1 - secret:'+ secret);
+    console.log('Successfully registered ' + enrollment_id + ' - secret:'+ secret);
 
-    return fabric_ca_client.enroll({enrollmentID: 'user1', enrollmentSecret: secret});
+    return fabric_ca_client.enroll({enrollmentID: enrollment_id, enrollmentSecret: secret});
 }).then((enrollment) => {
-  console.log('Successfully enrolled member user "user1" ');
+  console.log('Successfully enrolled member user "' + enrollment_id + '" ');
   return fabric_client.createUser(
-     {username: 'user1',
+     {username: enrollment_id,
      mspid: 'Org1MSP',
      cryptoContent: { privateKeyPEM: enrollment.key.toBytes(), signedCertPEM: enrollment.certificate }
      });
@@ -71,7 +84,7 @@ Fabric_Client.newDefaultKeyValueStore({ path: store_path
 
      return fabric_client.setUserContext(member_user);
 }).then(()=>{
-     console.log('User1 was successfully registered and enrolled and is ready to interact with the fabric network');
+     console.log(enrollment_id + ' was successfully registered and enrolled and is ready to interact with the fabric network');
 
 }).catch((err) => {
     console.error('Failed to register: ' + err);